@@ -2,22 +2,52 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
+	"github.com/Frozelo/FeedBackManagerBot/internal/supervisor"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
+	"net/http"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Bot struct {
-	bot *tgbotapi.BotAPI
-	cmd map[string]ViewFunc
-	cb  map[string]CallBackFunc
+	bot    *tgbotapi.BotAPI
+	outbox *outbox.Queue
+	cmd    map[string]ViewFunc
+	cb     map[string]CallBackFunc
+	// offset is the id of the next update to get.
+	offset atomic.Int64
+	// polled is closed when the poller of the last run has returned. Start
+	// is only ever run by one worker at a time, so it needs no lock.
+	polled chan struct{}
 }
 
-func New(bot *tgbotapi.BotAPI) *Bot {
-	return &Bot{bot: bot}
+const (
+	pollTimeout = 60
+	pollRetry   = 3 * time.Second
+)
+
+func New(bot *tgbotapi.BotAPI, queue *outbox.Queue) *Bot {
+	return &Bot{bot: bot, outbox: queue}
+}
+
+// replier is the Sender the views of one update get.
+type replier struct {
+	ctx context.Context
+	bot *Bot
+}
+
+func (r replier) Send(msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return r.bot.outbox.Send(r.ctx, msg, outbox.Interactive)
+}
+
+func (r replier) Download(ctx context.Context, document *tgbotapi.Document) ([]byte, error) {
+	return downloadDocument(ctx, r.bot.bot, document)
 }
 
 func (b *Bot) RegisterCmd(cmd string, viewFunc ViewFunc) {
@@ -34,23 +64,81 @@ func (b *Bot) RegisterCallback(cmd string, callback CallBackFunc) {
 	b.cb[cmd] = callback
 }
 
+// Start polls Telegram for updates and handles them until ctx is done. An
+// invalid token is reported as fatal, as no restart can fix it.
 func (b *Bot) Start(ctx context.Context) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	// The poller belongs to this run only. A cancelled poller still waits
+	// for its long poll to return, and Telegram answers 409 Conflict to a
+	// second one, so a restart waits for the old poller first.
+	if b.polled != nil {
+		select {
+		case <-b.polled:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	updates := make(chan tgbotapi.Update, b.bot.Buffer)
+	errc := make(chan error, 1)
+	polled := make(chan struct{})
+	b.polled = polled
+	go func() {
+		defer close(polled)
+		b.poll(pollCtx, updates, errc)
+	}()
 
-	updates := b.bot.GetUpdatesChan(u)
 	for {
 		select {
 		case update := <-updates:
 			updateCtx, updateCancel := context.WithTimeout(context.Background(), 5*time.Minute)
 			b.handleUpdate(updateCtx, update)
 			updateCancel()
+		case err := <-errc:
+			return err
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 	}
 }
 
+// poll long-polls getUpdates until ctx is done. The offset is kept on the
+// Bot, so a restarted poller goes on where the last one stopped.
+func (b *Bot) poll(ctx context.Context, updates chan<- tgbotapi.Update, errc chan<- error) {
+	for ctx.Err() == nil {
+		u := tgbotapi.NewUpdate(int(b.offset.Load()))
+		u.Timeout = pollTimeout
+
+		received, err := b.bot.GetUpdates(u)
+		if err != nil {
+			var apiErr *tgbotapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized {
+				errc <- fmt.Errorf("get updates: %w: %v", supervisor.ErrFatal, err)
+				return
+			}
+			log.Printf("[ERROR] failed to get updates, retrying in %s: %v", pollRetry, err)
+			select {
+			case <-time.After(pollRetry):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		for _, update := range received {
+			if int64(update.UpdateID) < b.offset.Load() {
+				continue
+			}
+			select {
+			case updates <- update:
+				b.offset.Store(int64(update.UpdateID) + 1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
 func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -71,21 +159,42 @@ func (b *Bot) handleMessage(ctx context.Context, update tgbotapi.Update) {
 
 	var view ViewFunc
 	cmd := update.Message.Command()
+	if cmd == "" {
+		cmd = captionCommand(update.Message)
+	}
 	cmdView, ok := b.cmd[cmd]
 	if !ok {
 		return
 	}
 	view = cmdView
 
-	if err := view(ctx, b.bot, update); err != nil {
+	reply := replier{ctx: ctx, bot: b}
+	if err := view(ctx, reply, update); err != nil {
 		log.Printf("[ERROR] failed to execute view: %v", err)
 
-		if _, err := b.bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("internal error: %s", err))); err != nil {
+		if _, err := reply.Send(tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("internal error: %s", err))); err != nil {
 			log.Printf("[ERROR] failed to send error message: %v", err)
 		}
 	}
 }
 
+// captionCommand reads a command from the caption of an attachment, so a
+// file can be sent together with the command that takes it.
+func captionCommand(msg *tgbotapi.Message) string {
+	if len(msg.CaptionEntities) == 0 {
+		return ""
+	}
+	entity := msg.CaptionEntities[0]
+	if entity.Type != "bot_command" || entity.Offset != 0 || entity.Length < 2 || entity.Length > len(msg.Caption) {
+		return ""
+	}
+	command := msg.Caption[1:entity.Length]
+	if i := strings.Index(command, "@"); i != -1 {
+		command = command[:i]
+	}
+	return command
+}
+
 func (b *Bot) handleCallback(ctx context.Context, update tgbotapi.Update) {
 	callbackData := update.CallbackQuery.Data
 	parts := strings.Split(callbackData, ":")
@@ -97,9 +206,10 @@ func (b *Bot) handleCallback(ctx context.Context, update tgbotapi.Update) {
 		return
 	}
 
-	if err := callbackFunc(ctx, b.bot, update); err != nil {
+	reply := replier{ctx: ctx, bot: b}
+	if err := callbackFunc(ctx, reply, update); err != nil {
 		log.Printf("[ERROR] failed to execute callback: %v", err)
-		if _, err := b.bot.Send(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("internal error: %s", err))); err != nil {
+		if _, err := reply.Send(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("internal error: %s", err))); err != nil {
 			log.Printf("[ERROR] failed to send error message: %v", err)
 		}
 	}
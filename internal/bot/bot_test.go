@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTelegram answers getMe and holds every getUpdates open until it is
+// released, like a long poll with no updates. It notes when a getUpdates
+// arrives while another one is still open, which Telegram answers with 409
+// Conflict.
+type fakeTelegram struct {
+	release chan struct{}
+	polls   chan struct{}
+
+	mu       sync.Mutex
+	open     int
+	conflict bool
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/getMe") {
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"test","username":"test_bot"}}`))
+		return
+	}
+
+	f.mu.Lock()
+	if f.open > 0 {
+		f.conflict = true
+	}
+	f.open++
+	f.mu.Unlock()
+	f.polls <- struct{}{}
+
+	<-f.release
+	f.mu.Lock()
+	f.open--
+	f.mu.Unlock()
+	w.Write([]byte(`{"ok":true,"result":[]}`))
+}
+
+func TestRestartWaitsForOldPoll(t *testing.T) {
+	telegram := &fakeTelegram{release: make(chan struct{}), polls: make(chan struct{}, 4)}
+	server := httptest.NewServer(telegram)
+	defer server.Close()
+	defer close(telegram.release)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(api, nil)
+
+	// The first run is stopped while its long poll is open, as a failing
+	// worker would be before the supervisor restarts it.
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() { firstDone <- b.Start(firstCtx) }()
+	<-telegram.polls
+	stopFirst()
+	if err := <-firstDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first run returned %v", err)
+	}
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go b.Start(secondCtx)
+
+	select {
+	case <-telegram.polls:
+		t.Fatal("the new run polled while the old long poll was still open")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Once the old long poll returns, its loop exits and the new one polls.
+	telegram.release <- struct{}{}
+	select {
+	case <-telegram.polls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new run never polled")
+	}
+	telegram.mu.Lock()
+	defer telegram.mu.Unlock()
+	if telegram.conflict {
+		t.Error("two long polls were open at once")
+	}
+}
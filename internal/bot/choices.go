@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Frozelo/FeedBackManagerBot/internal/discovery"
+	"sync"
+	"time"
+)
+
+const feedChoiceTTL = time.Hour
+
+type feedChoice struct {
+	feeds   []discovery.Feed
+	created time.Time
+}
+
+// FeedChoices keeps discovered feeds between the /addsource reply and the
+// button press. Telegram limits callback data to 64 bytes, too little for
+// feed URLs, so buttons carry a short token instead.
+type FeedChoices struct {
+	mu      sync.Mutex
+	choices map[string]feedChoice
+}
+
+func NewFeedChoices() *FeedChoices {
+	return &FeedChoices{choices: make(map[string]feedChoice)}
+}
+
+func (c *FeedChoices) Put(feeds []discovery.Feed) (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, choice := range c.choices {
+		if time.Since(choice.created) > feedChoiceTTL {
+			delete(c.choices, key)
+		}
+	}
+	c.choices[token] = feedChoice{feeds: feeds, created: time.Now()}
+	return token, nil
+}
+
+func (c *FeedChoices) Get(token string, index int) (discovery.Feed, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	choice, ok := c.choices[token]
+	if !ok || time.Since(choice.created) > feedChoiceTTL || index < 0 || index >= len(choice.feeds) {
+		return discovery.Feed{}, false
+	}
+	return choice.feeds[index], true
+}
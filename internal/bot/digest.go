@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+const digestUsage = `Использование:
+/digest now — показать дайджест сейчас
+/digest daily 09:00 [часовой пояс] — дайджест каждый день
+/digest weekly mon 09:00 [часовой пояс] — дайджест раз в неделю
+/digest off — присылать статьи сразу
+Часовой пояс указывается как Europe/Moscow`
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"вс": time.Sunday, "пн": time.Monday, "вт": time.Tuesday, "ср": time.Wednesday,
+	"чт": time.Thursday, "пт": time.Friday, "сб": time.Saturday,
+}
+
+// everyWeekday is "every <day>" with the gender of each day name.
+var everyWeekday = [...]string{"каждое воскресенье", "каждый понедельник", "каждый вторник", "каждую среду", "каждый четверг", "каждую пятницу", "каждую субботу"}
+
+type DeliverySettingsRepo interface {
+	GetUser(ctx context.Context, userID int64) (models.TgUser, error)
+	SetDeliverySettings(ctx context.Context, userID int64, settings models.DeliverySettings) error
+}
+
+type DigestPreviewer interface {
+	PreviewDigest(ctx context.Context, user models.TgUser) ([]string, error)
+}
+
+// CmdDigest shows and changes the user's delivery mode, or previews the
+// digest with /digest now.
+func CmdDigest(users DeliverySettingsRepo, previewer DigestPreviewer) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		user, err := users.GetUser(ctx, chatID)
+		if err != nil {
+			return err
+		}
+
+		args := strings.Fields(update.Message.CommandArguments())
+		if len(args) == 0 {
+			text := fmt.Sprintf("Сейчас: %s\n\n%s", describeDelivery(user.Delivery), digestUsage)
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, text))
+			return err
+		}
+
+		if strings.EqualFold(args[0], "now") {
+			texts, err := previewer.PreviewDigest(ctx, user)
+			if err != nil {
+				return err
+			}
+			if len(texts) == 0 {
+				_, err := bot.Send(tgbotapi.NewMessage(chatID, "Новых статей для дайджеста нет"))
+				return err
+			}
+			for _, text := range texts {
+				msg := tgbotapi.NewMessage(chatID, text)
+				msg.ParseMode = tgbotapi.ModeHTML
+				msg.DisableWebPagePreview = true
+				if _, err := bot.Send(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		settings, err := parseDigestSettings(args, user.Delivery)
+		if err != nil {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%v\n\n%s", err, digestUsage)))
+			return err
+		}
+		if err := users.SetDeliverySettings(ctx, chatID, settings); err != nil {
+			return err
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, "Готово: "+describeDelivery(settings))); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// parseDigestSettings reads "off", "daily HH:MM [zone]" or
+// "weekly <day> HH:MM [zone]"; the zone defaults to the current one.
+func parseDigestSettings(args []string, current models.DeliverySettings) (models.DeliverySettings, error) {
+	settings := current
+	if settings.Timezone == "" {
+		settings.Timezone = "UTC"
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "off", "instant":
+		settings.Mode = models.DeliveryModeInstant
+		return settings, nil
+	case "daily":
+		settings.Weekday = -1
+		args = args[1:]
+	case "weekly":
+		if len(args) < 2 {
+			return current, fmt.Errorf("не указан день недели")
+		}
+		day, ok := weekdays[strings.ToLower(args[1])]
+		if !ok {
+			return current, fmt.Errorf("неизвестный день недели %q", args[1])
+		}
+		settings.Weekday = int(day)
+		args = args[2:]
+	default:
+		return current, fmt.Errorf("неизвестный режим %q", args[0])
+	}
+
+	if len(args) == 0 || len(args) > 2 {
+		return current, fmt.Errorf("укажите время в формате ЧЧ:ММ")
+	}
+	at, err := time.Parse("15:04", args[0])
+	if err != nil {
+		return current, fmt.Errorf("неверное время %q, нужно ЧЧ:ММ", args[0])
+	}
+	settings.Minute = at.Hour()*60 + at.Minute()
+	if len(args) == 2 {
+		if _, err := time.LoadLocation(args[1]); err != nil {
+			return current, fmt.Errorf("неизвестный часовой пояс %q", args[1])
+		}
+		settings.Timezone = args[1]
+	}
+	settings.Mode = models.DeliveryModeDigest
+	return settings, nil
+}
+
+func describeDelivery(settings models.DeliverySettings) string {
+	if settings.Mode != models.DeliveryModeDigest {
+		return "статьи приходят сразу"
+	}
+	at := fmt.Sprintf("%02d:%02d", settings.Minute/60, settings.Minute%60)
+	if settings.Weekday < 0 {
+		return fmt.Sprintf("дайджест каждый день в %s (%s)", at, settings.Timezone)
+	}
+	return fmt.Sprintf("дайджест %s в %s (%s)", everyWeekday[settings.Weekday], at, settings.Timezone)
+}
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/opml"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	maxImportSize  = 1 << 20
+	maxImportFeeds = 500
+)
+
+type CategorizedSubsRepo interface {
+	SubsRepo
+	SetCategory(ctx context.Context, userID int64, sourceID int64, category string) error
+	GetSubscriptionsByUserID(ctx context.Context, userID int64) ([]models.Subscription, error)
+}
+
+// CmdImport subscribes the user to the feeds of an OPML file, sent with
+// /import as the caption or answered with /import. Folders become the
+// categories of the subscriptions.
+func CmdImport(sourceRepo SourceRepository, subsRepo CategorizedSubsRepo) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		document := update.Message.Document
+		if document == nil && update.Message.ReplyToMessage != nil {
+			document = update.Message.ReplyToMessage.Document
+		}
+		if document == nil {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, "Отправьте OPML-файл с подписью /import или ответьте на него командой /import"))
+			return err
+		}
+
+		body, err := bot.Download(ctx, document)
+		if err != nil {
+			return err
+		}
+		feeds, err := opml.Parse(bytes.NewReader(body))
+		if err != nil {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось прочитать OPML: %v", err)))
+			return err
+		}
+		if len(feeds) > maxImportFeeds {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("В файле %d лент, за раз можно импортировать не больше %d", len(feeds), maxImportFeeds)))
+			return err
+		}
+
+		imported, skipped := 0, 0
+		for _, feed := range feeds {
+			if !httpclient.PublicURL(feed.URL) {
+				skipped++
+				continue
+			}
+			sourceID, err := sourceRepo.Add(ctx, models.Source{
+				Name:      feed.Title,
+				Type:      models.SourceTypeRSS,
+				FeedURL:   feed.URL,
+				CreatedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				return err
+			}
+			if err := subsRepo.Add(ctx, chatID, sourceID); err != nil {
+				return err
+			}
+			if feed.Category != "" {
+				if err := subsRepo.SetCategory(ctx, chatID, sourceID, feed.Category); err != nil {
+					return err
+				}
+			}
+			imported++
+		}
+
+		text := fmt.Sprintf("Импортировано лент: %d", imported)
+		if skipped > 0 {
+			text += fmt.Sprintf(", пропущено с неверным адресом: %d", skipped)
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdExport sends the user's subscriptions as an OPML file.
+func CmdExport(subsRepo CategorizedSubsRepo) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		subscriptions, err := subsRepo.GetSubscriptionsByUserID(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		if len(subscriptions) == 0 {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, "У вас пока нет подписок"))
+			return err
+		}
+
+		feeds := make([]opml.Feed, 0, len(subscriptions))
+		for _, sub := range subscriptions {
+			feeds = append(feeds, opml.Feed{
+				Title:    sub.Source.Name,
+				URL:      sub.Source.FeedURL,
+				Category: sub.Category,
+			})
+		}
+		var buf bytes.Buffer
+		if err := opml.Write(&buf, "FeedManagerBot subscriptions", feeds); err != nil {
+			return err
+		}
+
+		msg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "subscriptions.opml", Bytes: buf.Bytes()})
+		msg.Caption = fmt.Sprintf("Ваши подписки: %d", len(feeds))
+		if _, err := bot.Send(msg); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+func downloadDocument(ctx context.Context, bot *tgbotapi.BotAPI, document *tgbotapi.Document) ([]byte, error) {
+	if document.FileSize > maxImportSize {
+		return nil, fmt.Errorf("file is too large: %d bytes", document.FileSize)
+	}
+	fileURL, err := bot.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := bot.Client.Do(req)
+	if err != nil {
+		// The file URL holds the bot token, keep it out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxImportSize {
+		return nil, fmt.Errorf("file is too large")
+	}
+	return body, nil
+}
@@ -3,31 +3,98 @@ package bot
 import (
 	"context"
 	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/discovery"
+	"github.com/Frozelo/FeedBackManagerBot/internal/fetcher"
 	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
+	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
-type ViewFunc func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error
-type CallBackFunc func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error
+type ViewFunc func(ctx context.Context, bot Sender, update tgbotapi.Update) error
+type CallBackFunc func(ctx context.Context, bot Sender, update tgbotapi.Update) error
+
+// Sender is what views reply through. Their messages go through the
+// outbound queue ahead of notifications.
+type Sender interface {
+	Send(msg tgbotapi.Chattable) (tgbotapi.Message, error)
+	// Download fetches a document the user sent.
+	Download(ctx context.Context, document *tgbotapi.Document) ([]byte, error)
+}
 
 type SourceRepository interface {
-	Add(ctx context.Context, source models.Source) error
+	Add(ctx context.Context, source models.Source) (int64, error)
 	Sources(ctx context.Context) ([]models.Source, error)
 }
 type SubsRepo interface {
 	Add(ctx context.Context, userId int64, sourceId int64) error
 }
 
+type FeedDiscoverer interface {
+	Discover(ctx context.Context, pageURL string) ([]discovery.Feed, error)
+}
+
+type SourceScheduler interface {
+	PinInterval(ctx context.Context, sourceID int64, interval time.Duration) error
+}
+
+type SourcePrioritizer interface {
+	SetPriority(ctx context.Context, sourceID int64, priority int) error
+}
+
+type SourceProxySetter interface {
+	SetProxy(ctx context.Context, sourceID int64, proxy string) error
+}
+
+// ProxyClients checks a proxy by building the client for it.
+type ProxyClients interface {
+	Client(proxy string) (*http.Client, error)
+}
+
+type SubscriptionWeights interface {
+	GetSubscriptionsByUserID(ctx context.Context, userID int64) ([]models.Subscription, error)
+	SetWeight(ctx context.Context, userID int64, sourceID int64, weight int) (bool, error)
+}
+
+type SourceEnabler interface {
+	Enable(ctx context.Context, sourceID int64) error
+}
+
+type FetchRunLister interface {
+	Recent(ctx context.Context, sourceID int64, limit int) ([]models.FetchRun, error)
+}
+
+type FetchMetricsReporter interface {
+	Metrics() fetcher.Metrics
+}
+
+type FilterStatsReporter interface {
+	FilterStats() map[string]int64
+}
+
+type Refresher interface {
+	RefreshSource(ctx context.Context, sourceID int64) (models.FetchRun, error)
+	RefreshAll(ctx context.Context) ([]models.FetchRun, error)
+}
+
+// Outbox sends messages outside of a view, after its update is handled.
+type Outbox interface {
+	Send(ctx context.Context, msg tgbotapi.Chattable, priority outbox.Priority) (tgbotapi.Message, error)
+}
+
 type UserRepository interface {
 	AddTgUser(ctx context.Context, tgUser models.TgUser) error
 }
 
 func CmdStart(userRepo UserRepository) ViewFunc {
-	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
 		if err := userRepo.AddTgUser(ctx, models.TgUser{
 			TgId:     update.Message.Chat.ID,
 			Username: update.Message.From.UserName,
@@ -43,8 +110,15 @@ func CmdStart(userRepo UserRepository) ViewFunc {
 	}
 }
 
-func CmdAddSource(sourceRepo SourceRepository) ViewFunc {
-	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error {
+// CmdAddSource without arguments offers the known sources to subscribe to.
+// With a URL, /addsource <url>, it discovers the feeds behind the page and
+// adds the one the user picks.
+func CmdAddSource(sourceRepo SourceRepository, subsRepo SubsRepo, discoverer FeedDiscoverer, choices *FeedChoices) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		if pageURL := strings.TrimSpace(update.Message.CommandArguments()); pageURL != "" {
+			return discoverSource(ctx, bot, update.Message.Chat.ID, pageURL, sourceRepo, subsRepo, discoverer, choices)
+		}
+
 		sources, err := sourceRepo.Sources(ctx)
 		if err != nil {
 			return err
@@ -64,8 +138,59 @@ func CmdAddSource(sourceRepo SourceRepository) ViewFunc {
 
 }
 
+func discoverSource(ctx context.Context, bot Sender, chatID int64, pageURL string, sourceRepo SourceRepository, subsRepo SubsRepo, discoverer FeedDiscoverer, choices *FeedChoices) error {
+	feeds, err := discoverer.Discover(ctx, pageURL)
+	if err != nil {
+		return err
+	}
+
+	switch len(feeds) {
+	case 0:
+		_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось найти RSS-ленту по адресу %s", pageURL)))
+		return err
+	case 1:
+		return addDiscoveredFeed(ctx, bot, chatID, feeds[0], sourceRepo, subsRepo)
+	}
+
+	token, err := choices.Put(feeds)
+	if err != nil {
+		return err
+	}
+	msg := tgbotapi.NewMessage(chatID, "На странице несколько лент. Какую добавить?")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, feed := range feeds {
+		button := tgbotapi.NewInlineKeyboardButtonData(feed.Title, fmt.Sprintf("feed_pick:%s:%d", token, i))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := bot.Send(msg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func addDiscoveredFeed(ctx context.Context, bot Sender, chatID int64, feed discovery.Feed, sourceRepo SourceRepository, subsRepo SubsRepo) error {
+	sourceID, err := sourceRepo.Add(ctx, models.Source{
+		Name:      feed.Title,
+		Type:      models.SourceTypeRSS,
+		FeedURL:   feed.URL,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := subsRepo.Add(ctx, chatID, sourceID); err != nil {
+		return err
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q добавлен, вы на него подписаны", feed.Title))
+	if _, err := bot.Send(msg); err != nil {
+		return err
+	}
+	return nil
+}
+
 func CmdListSource(sourceRepo SourceRepository) ViewFunc {
-	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
 		sources, err := sourceRepo.Sources(ctx)
 		if err != nil {
 			return err
@@ -95,7 +220,7 @@ func CmdListSource(sourceRepo SourceRepository) ViewFunc {
 }
 
 func CallbackAddSource(subsRepo SubsRepo) CallBackFunc {
-	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) error {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
 		callbackData := update.CallbackQuery.Data
 		parts := strings.Split(callbackData, ":")
 		if len(parts) != 2 || parts[0] != "source_add" {
@@ -116,3 +241,585 @@ func CallbackAddSource(subsRepo SubsRepo) CallBackFunc {
 		return nil
 	}
 }
+
+// AdminOnly restricts a command to the chat IDs listed as admins.
+func AdminOnly(admins []int64, view ViewFunc) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		if isAdmin(admins, update.Message) {
+			return view(ctx, bot, update)
+		}
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Эта команда доступна только администраторам")
+		if _, err := bot.Send(msg); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+func isAdmin(admins []int64, msg *tgbotapi.Message) bool {
+	for _, admin := range admins {
+		if msg.From != nil && msg.From.ID == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// CmdSetInterval pins the polling interval of a source:
+// /setinterval <source id> <duration|auto>
+func CmdSetInterval(scheduler SourceScheduler) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		args := strings.Fields(update.Message.CommandArguments())
+		if len(args) != 2 {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Использование: /setinterval <id источника> <интервал, например 30m, или auto>")
+			_, err := bot.Send(msg)
+			return err
+		}
+		sourceID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid source id %q", args[0])
+		}
+
+		var interval time.Duration
+		if args[1] != "auto" {
+			interval, err = time.ParseDuration(args[1])
+			if err != nil || interval <= 0 {
+				return fmt.Errorf("invalid interval %q", args[1])
+			}
+		}
+		if err := scheduler.PinInterval(ctx, sourceID, interval); err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("Источник %d теперь опрашивается каждые %s", sourceID, interval)
+		if interval == 0 {
+			text = fmt.Sprintf("Источник %d снова опрашивается по адаптивному расписанию", sourceID)
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// maxPriority bounds source priorities and subscription weights; one point
+// is worth notifier.Ranking.PriorityStep of article age.
+const maxPriority = 10
+
+// parsePriority reads a priority or weight within ±maxPriority.
+func parsePriority(arg string) (int, bool) {
+	value, err := strconv.Atoi(arg)
+	if err != nil || value < -maxPriority || value > maxPriority {
+		return 0, false
+	}
+	return value, true
+}
+
+// CmdSetPriority sets the priority of a source for everyone:
+// /setpriority <source> <-10..10>
+func CmdSetPriority(sourceRepo SourceRepository, prioritizer SourcePrioritizer) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		args := strings.Fields(update.Message.CommandArguments())
+		var priority int
+		ok := len(args) == 2
+		if ok {
+			priority, ok = parsePriority(args[1])
+		}
+		if !ok {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Использование: /setpriority <id или имя источника> <приоритет от %d до %d>", -maxPriority, maxPriority)))
+			return err
+		}
+
+		sources, err := sourceRepo.Sources(ctx)
+		if err != nil {
+			return err
+		}
+		source, found := findSource(sources, args[0])
+		if !found {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q не найден", args[0])))
+			return err
+		}
+		if err := prioritizer.SetPriority(ctx, source.ID, priority); err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("Приоритет источника %s: %d", source.Name, priority)
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdSetProxy sets the proxy a source is fetched through, or goes back to
+// the global one: /setproxy <source> <url|off>
+func CmdSetProxy(sourceRepo SourceRepository, proxies SourceProxySetter, clients ProxyClients) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		args := strings.Fields(update.Message.CommandArguments())
+		if len(args) != 2 {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, "Использование: /setproxy <id или имя источника> <http://, https:// или socks5:// адрес прокси, или off>"))
+			return err
+		}
+
+		proxy := args[1]
+		if proxy == "off" {
+			proxy = ""
+		} else if _, err := clients.Client(proxy); err != nil {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Неверный прокси: %v", err)))
+			return err
+		}
+
+		sources, err := sourceRepo.Sources(ctx)
+		if err != nil {
+			return err
+		}
+		source, found := findSource(sources, args[0])
+		if !found {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q не найден", args[0])))
+			return err
+		}
+		if err := proxies.SetProxy(ctx, source.ID, proxy); err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("Источник %s теперь опрашивается через %s", source.Name, redactProxy(proxy))
+		if proxy == "" {
+			text = fmt.Sprintf("Источник %s снова опрашивается через общий прокси", source.Name)
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// redactProxy hides the password of a proxy URL.
+func redactProxy(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return proxy
+	}
+	return proxyURL.Redacted()
+}
+
+// CmdWeight lists the user's weights for their sources, or sets one:
+// /weight <source> <-10..10>. A weight is added to the source priority
+// when the user's articles are ranked.
+func CmdWeight(sourceRepo SourceRepository, weights SubscriptionWeights) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		args := strings.Fields(update.Message.CommandArguments())
+		usage := fmt.Sprintf("Использование: /weight <id или имя источника> <вес от %d до %d>", -maxPriority, maxPriority)
+
+		if len(args) == 0 {
+			subscriptions, err := weights.GetSubscriptionsByUserID(ctx, chatID)
+			if err != nil {
+				return err
+			}
+			if len(subscriptions) == 0 {
+				_, err := bot.Send(tgbotapi.NewMessage(chatID, "У вас нет подписок"))
+				return err
+			}
+			lines := []string{"Ваши веса источников:"}
+			for _, sub := range subscriptions {
+				lines = append(lines, fmt.Sprintf("%s [%d] — вес %d, приоритет %d", sub.Source.Name, sub.Source.ID, sub.Weight, sub.Source.Priority))
+			}
+			lines = append(lines, "", usage)
+			_, err = bot.Send(tgbotapi.NewMessage(chatID, strings.Join(lines, "\n")))
+			return err
+		}
+
+		var weight int
+		ok := len(args) == 2
+		if ok {
+			weight, ok = parsePriority(args[1])
+		}
+		if !ok {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, usage))
+			return err
+		}
+
+		sources, err := sourceRepo.Sources(ctx)
+		if err != nil {
+			return err
+		}
+		source, found := findSource(sources, args[0])
+		if !found {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q не найден", args[0])))
+			return err
+		}
+		subscribed, err := weights.SetWeight(ctx, chatID, source.ID, weight)
+		if err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("Вес источника %s: %d", source.Name, weight)
+		if !subscribed {
+			text = fmt.Sprintf("Вы не подписаны на %s", source.Name)
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdSourceStatus shows the health of all sources, or the details of one
+// source given by ID or name: /sourcestatus [source]
+func CmdSourceStatus(sourceRepo SourceRepository) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		sources, err := sourceRepo.Sources(ctx)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(sources, func(i, j int) bool {
+			return sources[i].Name < sources[j].Name
+		})
+
+		var text string
+		if arg := strings.TrimSpace(update.Message.CommandArguments()); arg != "" {
+			source, ok := findSource(sources, arg)
+			if !ok {
+				text = fmt.Sprintf("Источник %q не найден", arg)
+			} else {
+				text = formatSourceHealth(source)
+			}
+		} else {
+			lines := []string{fmt.Sprintf("Состояние источников (всего %d):", len(sources))}
+			for _, source := range sources {
+				lines = append(lines, fmt.Sprintf("%s [%d] — %s", source.Name, source.ID, sourceState(source)))
+			}
+			text = strings.Join(lines, "\n")
+		}
+
+		if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, text)); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdEnableSource re-enables a source that was disabled: /enablesource <source id>
+func CmdEnableSource(enabler SourceEnabler) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		sourceID, err := strconv.ParseInt(strings.TrimSpace(update.Message.CommandArguments()), 10, 64)
+		if err != nil {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Использование: /enablesource <id источника>")
+			_, err := bot.Send(msg)
+			return err
+		}
+		if err := enabler.Enable(ctx, sourceID); err != nil {
+			return err
+		}
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Источник %d снова включён", sourceID))
+		if _, err := bot.Send(msg); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// refreshTimeout bounds a refresh started from the bot.
+const refreshTimeout = 10 * time.Minute
+
+// CmdRefresh fetches one source, given by ID or name, right away:
+// /refresh [source]. Without a source it refreshes all of them, which is
+// left to admins. The refresh runs in the background and its result is
+// sent through the outbox when it is done; only one runs at a time.
+func CmdRefresh(admins []int64, sourceRepo SourceRepository, refresher Refresher, queue Outbox) ViewFunc {
+	var running atomic.Bool
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		chatID := update.Message.Chat.ID
+		arg := strings.TrimSpace(update.Message.CommandArguments())
+
+		var refresh func(ctx context.Context) (string, error)
+		if arg == "" {
+			if !isAdmin(admins, update.Message) {
+				_, err := bot.Send(tgbotapi.NewMessage(chatID, "Использование: /refresh <id или имя источника>"))
+				return err
+			}
+			refresh = func(ctx context.Context) (string, error) {
+				runs, err := refresher.RefreshAll(ctx)
+				if err != nil {
+					return "", err
+				}
+				found, failed := 0, 0
+				for _, run := range runs {
+					found += run.New
+					if run.Error != "" {
+						failed++
+					}
+				}
+				text := fmt.Sprintf("Опрошено источников: %d, новых статей: %d", len(runs), found)
+				if failed > 0 {
+					text += fmt.Sprintf(", с ошибками: %d", failed)
+				}
+				return text, nil
+			}
+		} else {
+			sources, err := sourceRepo.Sources(ctx)
+			if err != nil {
+				return err
+			}
+			source, ok := findSource(sources, arg)
+			if !ok {
+				_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q не найден", arg)))
+				return err
+			}
+			if source.Health.Disabled {
+				_, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Источник %q отключён", source.Name)))
+				return err
+			}
+			refresh = func(ctx context.Context) (string, error) {
+				run, err := refresher.RefreshSource(ctx, source.ID)
+				if err != nil {
+					return "", err
+				}
+				if run.Error != "" {
+					return fmt.Sprintf("%s: ошибка при опросе: %s", source.Name, run.Error), nil
+				}
+				return fmt.Sprintf("%s: новых статей %d", source.Name, run.New), nil
+			}
+		}
+
+		if !running.CompareAndSwap(false, true) {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, "Обновление уже идёт, дождитесь его окончания"))
+			return err
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(chatID, "Обновление запущено, пришлю результат, когда закончу")); err != nil {
+			running.Store(false)
+			return err
+		}
+
+		// The update's context ends with this view; the refresh must not.
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		go func() {
+			defer cancel()
+			defer running.Store(false)
+			text, err := refresh(refreshCtx)
+			if err != nil {
+				log.Printf("[ERROR] refresh failed: %v", err)
+				text = fmt.Sprintf("Обновление не удалось: %v", err)
+			}
+			if _, err := queue.Send(refreshCtx, tgbotapi.NewMessage(chatID, text), outbox.Interactive); err != nil {
+				log.Printf("[ERROR] failed to send refresh result to chat %d: %v", chatID, err)
+			}
+		}()
+		return nil
+	}
+}
+
+const (
+	defaultFetchLogRuns = 10
+	maxFetchLogRuns     = 50
+	// maxFetchLogError keeps a long run of failures within one message.
+	maxFetchLogError = 200
+)
+
+// CmdFetchLog shows the latest fetch runs of a source given by ID or name:
+// /fetchlog <source> [number of runs]
+func CmdFetchLog(sourceRepo SourceRepository, runs FetchRunLister) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		args := strings.Fields(update.Message.CommandArguments())
+		if len(args) == 0 {
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Использование: /fetchlog <id или имя источника> [количество запусков]")
+			_, err := bot.Send(msg)
+			return err
+		}
+		limit := defaultFetchLogRuns
+		if len(args) > 1 {
+			if n, err := strconv.Atoi(args[len(args)-1]); err == nil && n > 0 {
+				limit = min(n, maxFetchLogRuns)
+				args = args[:len(args)-1]
+			}
+		}
+
+		sources, err := sourceRepo.Sources(ctx)
+		if err != nil {
+			return err
+		}
+		arg := strings.Join(args, " ")
+		source, ok := findSource(sources, arg)
+		if !ok {
+			_, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Источник %q не найден", arg)))
+			return err
+		}
+
+		recent, err := runs.Recent(ctx, source.ID, limit)
+		if err != nil {
+			return err
+		}
+		lines := []string{fmt.Sprintf("Последние запуски %s [%d]:", source.Name, source.ID)}
+		if len(recent) == 0 {
+			lines = append(lines, "запусков ещё не было")
+		}
+		for _, run := range recent {
+			lines = append(lines, formatFetchRun(run))
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, strings.Join(lines, "\n"))); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdMetrics shows where fetching spends its time since start: waiting for
+// a worker and a host slot, and fetching and storing.
+func CmdMetrics(reporter FetchMetricsReporter) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		metrics := reporter.Metrics()
+		stat := func(name string, s fetcher.DurationStat) string {
+			return fmt.Sprintf("%s: %d раз, в среднем %s, максимум %s",
+				name, s.Count, s.Avg().Round(time.Millisecond), s.Max.Round(time.Millisecond))
+		}
+		lines := []string{
+			"Метрики опроса с момента запуска:",
+			stat("Ожидание в очереди", metrics.QueueWait),
+			stat("Опрос и сохранение", metrics.Fetch),
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, strings.Join(lines, "\n"))); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// CmdFilterStats shows how many items each keyword rule has dropped since
+// start. Per-source rules are listed as "<source name>/<rule name>".
+func CmdFilterStats(reporter FilterStatsReporter) ViewFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		stats := reporter.FilterStats()
+		rules := make([]string, 0, len(stats))
+		for rule := range stats {
+			rules = append(rules, rule)
+		}
+		sort.SliceStable(rules, func(i, j int) bool {
+			if stats[rules[i]] != stats[rules[j]] {
+				return stats[rules[i]] > stats[rules[j]]
+			}
+			return rules[i] < rules[j]
+		})
+
+		lines := []string{"Отброшено правилами фильтрации с момента запуска:"}
+		if len(rules) == 0 {
+			lines = append(lines, "ничего")
+		}
+		for _, rule := range rules {
+			lines = append(lines, fmt.Sprintf("%s — %d", rule, stats[rule]))
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, strings.Join(lines, "\n"))); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+func formatFetchRun(run models.FetchRun) string {
+	status := "HTTP —"
+	if run.HTTPStatus != 0 {
+		status = fmt.Sprintf("HTTP %d", run.HTTPStatus)
+	}
+	line := fmt.Sprintf("%s (%s) %s: элементов %d, новых %d, дублей %d, похожих заголовков %d, отфильтровано %d",
+		run.StartedAt.Format("2006-01-02 15:04:05"),
+		run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond),
+		status,
+		run.Items,
+		run.New,
+		run.Duplicates,
+		run.TitleDuplicates,
+		run.Filtered,
+	)
+	if run.Error != "" {
+		reason := []rune(run.Error)
+		if len(reason) > maxFetchLogError {
+			reason = append(reason[:maxFetchLogError], '…')
+		}
+		line += "\n  ошибка: " + string(reason)
+	}
+	return line
+}
+
+func findSource(sources []models.Source, arg string) (models.Source, bool) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		for _, source := range sources {
+			if source.ID == id {
+				return source, true
+			}
+		}
+	}
+	for _, source := range sources {
+		if strings.EqualFold(source.Name, arg) {
+			return source, true
+		}
+	}
+	return models.Source{}, false
+}
+
+func sourceState(source models.Source) string {
+	switch {
+	case source.Health.Disabled:
+		return "отключён"
+	case source.Health.ConsecutiveFailures > 0:
+		return fmt.Sprintf("ошибки (%d подряд)", source.Health.ConsecutiveFailures)
+	case source.Health.LastSuccessAt.IsZero():
+		return "ещё не опрашивался"
+	default:
+		return "работает"
+	}
+}
+
+func formatSourceHealth(source models.Source) string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s [%d]", source.Name, source.ID),
+		fmt.Sprintf("URL: %s", source.FeedURL),
+		fmt.Sprintf("Состояние: %s", sourceState(source)),
+		fmt.Sprintf("Последний успех: %s", formatTime(source.Health.LastSuccessAt)),
+		fmt.Sprintf("Последняя ошибка: %s", formatTime(source.Health.LastErrorAt)),
+		fmt.Sprintf("Ошибок подряд: %d", source.Health.ConsecutiveFailures),
+		fmt.Sprintf("Средняя задержка: %s", source.Health.AvgLatency),
+		fmt.Sprintf("Интервал опроса: %s, следующий опрос: %s", source.FetchInterval, formatTime(source.NextFetchAt)),
+	}
+	if source.Proxy != "" {
+		lines = append(lines, fmt.Sprintf("Прокси: %s", redactProxy(source.Proxy)))
+	}
+	if source.WebSub.Hub != "" {
+		lines = append(lines, fmt.Sprintf("WebSub: %s, подписка до %s", source.WebSub.Hub, formatTime(source.WebSub.LeaseExpiresAt)))
+	}
+	if source.Health.LastError != "" {
+		lines = append(lines, fmt.Sprintf("Текст ошибки: %s", source.Health.LastError))
+	}
+	if source.Health.Disabled {
+		lines = append(lines, fmt.Sprintf("Отключён: %s", formatTime(source.Health.DisabledAt)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func CallbackPickFeed(sourceRepo SourceRepository, subsRepo SubsRepo, choices *FeedChoices) CallBackFunc {
+	return func(ctx context.Context, bot Sender, update tgbotapi.Update) error {
+		parts := strings.Split(update.CallbackQuery.Data, ":")
+		if len(parts) != 3 || parts[0] != "feed_pick" {
+			return fmt.Errorf("invalid callback data")
+		}
+		index, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return err
+		}
+
+		chatID := update.CallbackQuery.Message.Chat.ID
+		feed, ok := choices.Get(parts[1], index)
+		if !ok {
+			_, err := bot.Send(tgbotapi.NewMessage(chatID, "Выбор устарел, отправьте /addsource ещё раз"))
+			return err
+		}
+		return addDiscoveredFeed(ctx, bot, chatID, feed, sourceRepo, subsRepo)
+	}
+}
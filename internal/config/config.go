@@ -2,24 +2,80 @@ package config
 
 import (
 	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
+	"github.com/Frozelo/FeedBackManagerBot/internal/websub"
 	"gopkg.in/yaml.v3"
 	"os"
 	"sync"
+	"time"
 )
 
 type (
 	Config struct {
 		TelegramBot `yaml:"telegramBot"`
 		Postgres    `yaml:"postgres"`
+		Fetcher     `yaml:"fetcher"`
+		Notifier    `yaml:"notifier"`
+		HTTP        httpclient.Config `yaml:"http"`
+		WebSub      websub.Config     `yaml:"websub"`
+		Outbox      outbox.Config     `yaml:"outbox"`
 	}
 
 	TelegramBot struct {
-		Token string `yaml:"token"`
+		Token  string  `yaml:"token"`
+		Admins []int64 `yaml:"admins"`
 	}
 
 	Postgres struct {
 		ConnString string `yaml:"connString"`
 	}
+
+	Fetcher struct {
+		Filters     models.FilterRules `yaml:"filters"`
+		Concurrency int                `yaml:"concurrency"`
+		PerHost     PerHost            `yaml:"perHost"`
+		Schedule    Schedule           `yaml:"schedule"`
+		MaxFailures int                `yaml:"maxFailures"`
+		Dates       Dates              `yaml:"dates"`
+		Titles      Titles             `yaml:"titles"`
+	}
+
+	PerHost struct {
+		MaxConcurrent int           `yaml:"maxConcurrent"`
+		MinDelay      time.Duration `yaml:"minDelay"`
+	}
+
+	Schedule struct {
+		DefaultInterval time.Duration `yaml:"defaultInterval"`
+		MinInterval     time.Duration `yaml:"minInterval"`
+		MaxInterval     time.Duration `yaml:"maxInterval"`
+		// PushInterval is the fallback polling interval for sources that
+		// receive WebSub pushes.
+		PushInterval time.Duration `yaml:"pushInterval"`
+	}
+
+	// Notifier controls how often and how many articles are sent; see
+	// notifier.Ranking.
+	Notifier struct {
+		SendInterval    time.Duration `yaml:"sendInterval"`
+		ArticlesPerTick int           `yaml:"articlesPerTick"`
+		PriorityStep    time.Duration `yaml:"priorityStep"`
+	}
+
+	// Titles tunes the similar-title check; see fetcher.Titles.
+	Titles struct {
+		Threshold float64       `yaml:"threshold"`
+		Window    time.Duration `yaml:"window"`
+		Disabled  bool          `yaml:"disabled"`
+	}
+
+	// Dates are the sanity windows for item dates; see fetcher.Dates.
+	Dates struct {
+		MaxFuture time.Duration `yaml:"maxFuture"`
+		MaxAge    time.Duration `yaml:"maxAge"`
+	}
 )
 
 var (
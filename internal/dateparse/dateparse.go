@@ -0,0 +1,60 @@
+package dateparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layouts are tried in order when no explicit layout is configured.
+var layouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC850,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// Parse reads a date using layout, or one of the common layouts when layout
+// is empty. The "unix" and "unixms" layouts read epoch seconds and
+// milliseconds. Dates without a zone are taken as UTC.
+func Parse(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	switch layout {
+	case "unix", "unixms":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid epoch date %q: %w", value, err)
+		}
+		if layout == "unixms" {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	case "":
+		for _, candidate := range layouts {
+			if t, err := time.Parse(candidate, value); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+	default:
+		return time.Parse(layout, value)
+	}
+}
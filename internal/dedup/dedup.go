@@ -0,0 +1,150 @@
+package dedup
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// trackingParams are query parameters that identify a campaign or a click,
+// not the content, and are dropped from canonical URLs.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "yclid": true, "dclid": true, "msclkid": true,
+	"mc_cid": true, "mc_eid": true, "igshid": true, "_ga": true, "_hsenc": true,
+	"_hsmi": true, "ref": true, "ref_src": true, "cmpid": true, "amp": true,
+	"outputtype": true,
+}
+
+// CanonicalURL normalises a link so that variants of the same article
+// compare equal: the scheme is forced to https, the host is lower-cased and
+// stripped of "www." and "amp.", default ports, fragments, tracking
+// parameters, AMP path suffixes and trailing slashes are removed and the
+// remaining query parameters are sorted. Unparseable links are returned
+// trimmed but otherwise unchanged.
+func CanonicalURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+
+	u.Scheme = "https"
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "amp.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	path := u.Path
+	for _, suffix := range []string{"/amp/", "/amp", ".amp"} {
+		if strings.HasSuffix(path, suffix) {
+			path = strings.TrimSuffix(path, suffix)
+			break
+		}
+	}
+	u.Path = strings.TrimRight(path, "/")
+	u.RawPath = ""
+
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key.
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// TitleSimilarity returns the Jaccard similarity of the word sets of two
+// titles, ignoring case and punctuation: 1 for the same words, 0 for none
+// in common.
+func TitleSimilarity(a, b string) float64 {
+	wordsA, wordsB := titleWords(a), titleWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	common := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(wordsA)+len(wordsB)-common)
+}
+
+// Host returns the host of a canonical URL, empty when it has none.
+func Host(canonicalURL string) string {
+	u, err := url.Parse(canonicalURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// SimilarTitle returns the first of the known titles that closely matches
+// title. Titles of fewer than three words must match exactly, otherwise
+// short generic titles ("Weekly digest") would all collide. Titles with
+// different numbers never match, as those are usually recurring articles
+// ("Курс валют на 12 марта") rather than re-publications.
+func SimilarTitle(title string, known []string, threshold float64) (string, bool) {
+	words := titleWords(title)
+	numbers := titleNumbers(words)
+	for _, other := range known {
+		if len(words) < 3 {
+			if normalizedTitle(title) == normalizedTitle(other) && len(words) > 0 {
+				return other, true
+			}
+			continue
+		}
+		if titleNumbers(titleWords(other)) != numbers {
+			continue
+		}
+		if TitleSimilarity(title, other) >= threshold {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// titleNumbers joins the words of a title that contain digits, sorted.
+func titleNumbers(words map[string]bool) string {
+	var numbers []string
+	for word := range words {
+		if strings.IndexFunc(word, unicode.IsDigit) != -1 {
+			numbers = append(numbers, word)
+		}
+	}
+	sort.Strings(numbers)
+	return strings.Join(numbers, " ")
+}
+
+func titleWords(title string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+func normalizedTitle(title string) string {
+	words := make([]string, 0)
+	for word := range titleWords(title) {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,39 @@
+package dedup
+
+import (
+	"testing"
+)
+
+func TestSimilarTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		known string
+		want  bool
+	}{
+		{"Go 1.22 is released with range over integers", "Go 1.22 is released with range over integers!", true},
+		{"Go 1.22 is released with range over integers", "Go 1.22 released with range over integers", true},
+		{"Курс валют на 12 марта", "Курс валют на 13 марта", false},
+		{"Курс валют на 12 марта", "курс валют на 12 марта", true},
+		{"Weekly digest", "Weekly digest", true},
+		{"Weekly digest", "Weekly news", false},
+		{"New release of the compiler", "Security fix in the runtime", false},
+	}
+	for _, tt := range tests {
+		match, ok := SimilarTitle(tt.title, []string{"Unrelated title here", tt.known}, 0.85)
+		if ok != tt.want {
+			t.Errorf("SimilarTitle(%q, %q) = %v, want %v", tt.title, tt.known, ok, tt.want)
+		}
+		if ok && match != tt.known {
+			t.Errorf("SimilarTitle(%q) matched %q, want %q", tt.title, match, tt.known)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	if got := Host(CanonicalURL("http://www.Example.com/news/1?utm_source=x")); got != "example.com" {
+		t.Errorf("Host() = %q, want example.com", got)
+	}
+	if got := Host(""); got != "" {
+		t.Errorf("Host(\"\") = %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/SlyMarbo/rss"
+	"golang.org/x/net/html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const maxPageSize = 5 << 20
+
+// commonPaths are tried when a page does not advertise its feeds.
+var commonPaths = []string{"/feed", "/rss", "/rss.xml", "/feed.xml", "/atom.xml", "/index.xml", "/feed/"}
+
+var feedTypes = map[string]bool{
+	"application/rss+xml":  true,
+	"application/atom+xml": true,
+	"application/rdf+xml":  true,
+	"application/xml":      true,
+	"text/xml":             true,
+}
+
+type Feed struct {
+	URL   string
+	Title string
+}
+
+type Discoverer struct {
+	client *http.Client
+}
+
+func New(client *http.Client) *Discoverer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Discoverer{client: client}
+}
+
+// Discover finds the feeds behind a URL. A feed URL is returned as is;
+// for a web page the <link rel="alternate"> tags are used first and the
+// common feed paths second. Every candidate is fetched and parsed, so only
+// working feeds are returned, each with its own title.
+func (d *Discoverer) Discover(ctx context.Context, pageURL string) ([]Feed, error) {
+	if !strings.Contains(pageURL, "://") {
+		pageURL = "https://" + pageURL
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", pageURL, err)
+	}
+
+	body, err := d.get(ctx, base.String())
+	if err != nil {
+		return nil, err
+	}
+	if looksLikeFeed(body) {
+		feed, err := rss.Parse(body)
+		if err != nil {
+			return nil, err
+		}
+		return []Feed{{URL: base.String(), Title: feedTitle(feed, base.String())}}, nil
+	}
+
+	candidates := alternateLinks(body, base)
+	if len(candidates) == 0 {
+		for _, path := range commonPaths {
+			candidates = append(candidates, base.ResolveReference(&url.URL{Path: path}).String())
+		}
+	}
+
+	var feeds []Feed
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		feed, err := d.fetchFeed(ctx, candidate)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+func (d *Discoverer) fetchFeed(ctx context.Context, feedURL string) (Feed, error) {
+	body, err := d.get(ctx, feedURL)
+	if err != nil {
+		return Feed{}, err
+	}
+	if !looksLikeFeed(body) {
+		return Feed{}, fmt.Errorf("%q is not a feed", feedURL)
+	}
+	feed, err := rss.Parse(body)
+	if err != nil {
+		return Feed{}, err
+	}
+	return Feed{URL: feedURL, Title: feedTitle(feed, feedURL)}, nil
+}
+
+func (d *Discoverer) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %q", resp.Status, rawURL)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+}
+
+// alternateLinks returns the absolute URLs of the feeds a page links to.
+func alternateLinks(page []byte, base *url.URL) []string {
+	var links []string
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "body" {
+				return links
+			}
+			if token.Data != "link" {
+				continue
+			}
+
+			var rel, typ, href string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "rel":
+					rel = strings.ToLower(attr.Val)
+				case "type":
+					typ = strings.ToLower(strings.TrimSpace(attr.Val))
+				case "href":
+					href = strings.TrimSpace(attr.Val)
+				}
+			}
+			if !strings.Contains(rel, "alternate") || !feedTypes[typ] || href == "" {
+				continue
+			}
+			ref, err := url.Parse(href)
+			if err != nil {
+				continue
+			}
+			links = append(links, base.ResolveReference(ref).String())
+		}
+	}
+}
+
+// looksLikeFeed guards against rss.Parse, which treats anything that is not
+// RSS as Atom and happily parses HTML pages into empty feeds.
+func looksLikeFeed(body []byte) bool {
+	head := body
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	lower := bytes.ToLower(head)
+	return bytes.Contains(lower, []byte("<rss")) ||
+		bytes.Contains(lower, []byte("<feed")) ||
+		bytes.Contains(lower, []byte("<rdf:rdf"))
+}
+
+func feedTitle(feed *rss.Feed, feedURL string) string {
+	if title := strings.TrimSpace(feed.Title); title != "" {
+		return title
+	}
+	return feedURL
+}
@@ -0,0 +1,245 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// minTextLength is how much text the main block needs before the page is
+// considered to have an article at all.
+const minTextLength = 200
+
+var ErrNoContent = errors.New("no article content found")
+
+var (
+	// Class and id hints in the spirit of Readability.
+	unlikelyHints = regexp.MustCompile(`(?i)ad-|adbox|banner|breadcrumb|combx|comment|community|cookie|disqus|footer|header|menu|modal|newsletter|pagination|popup|promo|related|remark|share|sidebar|social|sponsor|subscribe|tags|toolbar|widget`)
+	positiveHints = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text`)
+	negativeHints = regexp.MustCompile(`(?i)comment|footer|meta|nav|promo|related|share|sidebar|social|sponsor|widget`)
+)
+
+// Result is what could be recovered from an article page. Content is raw
+// HTML with absolute links; callers sanitize it.
+type Result struct {
+	Content string
+	Image   string
+	Byline  string
+}
+
+// Extractor downloads article pages and pulls out the main text, the lead
+// image and the byline.
+type Extractor struct {
+	clients *httpclient.Factory
+}
+
+func New(clients *httpclient.Factory) *Extractor {
+	return &Extractor{clients: clients}
+}
+
+// Extract fetches pageURL through the source's proxy and extracts the
+// article from it. The URL comes from the feed, so only public addresses
+// are fetched.
+func (e *Extractor) Extract(ctx context.Context, source models.Source, pageURL string) (Result, error) {
+	client, err := e.clients.PublicClient(source.Proxy)
+	if err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return Result{}, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return Result{}, err
+	}
+	return extract(doc, resp.Request.URL)
+}
+
+func extract(doc *goquery.Document, base *url.URL) (Result, error) {
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(href); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+
+	result := Result{
+		Image:  resolve(base, metaContent(doc, `meta[property="og:image"]`, `meta[name="twitter:image"]`)),
+		Byline: byline(doc),
+	}
+
+	doc.Find("script, style, noscript, template, iframe, form, nav, aside, header, footer, svg, button, [role=navigation], [aria-hidden=true]").Remove()
+	doc.Find("[class], [id]").Each(func(_ int, sel *goquery.Selection) {
+		hints := classAndID(sel)
+		if unlikelyHints.MatchString(hints) && !positiveHints.MatchString(hints) && goquery.NodeName(sel) != "body" && goquery.NodeName(sel) != "article" {
+			sel.Remove()
+		}
+	})
+
+	main := mainBlock(doc)
+	if main == nil || len(strings.TrimSpace(main.Text())) < minTextLength {
+		return result, ErrNoContent
+	}
+
+	main.Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		sel.SetAttr("href", resolve(base, href))
+	})
+	main.Find("img").Each(func(_ int, sel *goquery.Selection) {
+		src := sel.AttrOr("src", "")
+		if src == "" {
+			src = sel.AttrOr("data-src", "")
+		}
+		if src == "" {
+			sel.Remove()
+			return
+		}
+		sel.SetAttr("src", resolve(base, src))
+	})
+
+	content, err := main.Html()
+	if err != nil {
+		return result, err
+	}
+	result.Content = strings.TrimSpace(content)
+	if result.Image == "" {
+		result.Image = main.Find("img[src]").First().AttrOr("src", "")
+	}
+	return result, nil
+}
+
+// mainBlock picks the element holding the article text. A single <article>
+// wins outright; otherwise every paragraph adds to the score of its parent
+// and, at half weight, its grandparent, and the best-scoring element after
+// a link-density penalty is taken.
+func mainBlock(doc *goquery.Document) *goquery.Selection {
+	if articles := doc.Find("article"); articles.Length() == 1 {
+		return articles
+	}
+
+	scores := make(map[*html.Node]float64)
+	nodes := make(map[*html.Node]*goquery.Selection)
+	addScore := func(sel *goquery.Selection, score float64) {
+		if sel.Length() == 0 {
+			return
+		}
+		node := sel.Get(0)
+		if _, ok := scores[node]; !ok {
+			nodes[node] = sel
+			scores[node] = classWeight(sel)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ","))
+		score += min(float64(len(text))/100, 3)
+		addScore(p.Parent(), score)
+		addScore(p.Parent().Parent(), score/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for node, score := range scores {
+		sel := nodes[node]
+		score *= 1 - linkDensity(sel)
+		if best == nil || score > bestScore {
+			best, bestScore = sel, score
+		}
+	}
+	if best == nil {
+		if body := doc.Find("body"); body.Length() > 0 {
+			return body
+		}
+	}
+	return best
+}
+
+func classAndID(sel *goquery.Selection) string {
+	return sel.AttrOr("class", "") + " " + sel.AttrOr("id", "")
+}
+
+func classWeight(sel *goquery.Selection) float64 {
+	hints := classAndID(sel)
+	weight := 0.0
+	if positiveHints.MatchString(hints) {
+		weight += 25
+	}
+	if negativeHints.MatchString(hints) {
+		weight -= 25
+	}
+	return weight
+}
+
+// linkDensity is the share of an element's text that sits inside links.
+func linkDensity(sel *goquery.Selection) float64 {
+	total := len(strings.TrimSpace(sel.Text()))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	sel.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linked += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(linked) / float64(total)
+}
+
+func byline(doc *goquery.Document) string {
+	if author := metaContent(doc, `meta[name="author"]`, `meta[property="article:author"]`); author != "" && !strings.Contains(author, "://") {
+		return author
+	}
+	for _, selector := range []string{`[rel="author"]`, `[itemprop="author"]`, ".byline", ".author"} {
+		if text := strings.Join(strings.Fields(doc.Find(selector).First().Text()), " "); text != "" && len(text) < 100 {
+			return text
+		}
+	}
+	return ""
+}
+
+func metaContent(doc *goquery.Document, selectors ...string) string {
+	for _, selector := range selectors {
+		if content := strings.TrimSpace(doc.Find(selector).First().AttrOr("content", "")); content != "" {
+			return content
+		}
+	}
+	return ""
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(parsed).String()
+}
@@ -0,0 +1,38 @@
+package fetcher
+
+import (
+	"time"
+)
+
+const (
+	defaultMaxFuture = 24 * time.Hour
+	defaultMaxAge    = 5 * 365 * 24 * time.Hour
+)
+
+// Dates bounds the item dates that are taken at face value. A date further
+// than MaxFuture ahead of the moment the item is first seen, or older than
+// MaxAge, is treated as bogus, like a missing one.
+type Dates struct {
+	MaxFuture time.Duration
+	MaxAge    time.Duration
+}
+
+func (d Dates) withDefaults() Dates {
+	if d.MaxFuture <= 0 {
+		d.MaxFuture = defaultMaxFuture
+	}
+	if d.MaxAge <= 0 {
+		d.MaxAge = defaultMaxAge
+	}
+	return d
+}
+
+// effective returns the date an item is stored and delivered by: its own
+// date when plausible, otherwise the first-seen time. The second result
+// reports whether the item's date was used.
+func (d Dates) effective(date, firstSeen time.Time) (time.Time, bool) {
+	if date.IsZero() || date.After(firstSeen.Add(d.MaxFuture)) || date.Before(firstSeen.Add(-d.MaxAge)) {
+		return firstSeen, false
+	}
+	return date.UTC(), true
+}
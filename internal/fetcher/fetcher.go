@@ -2,8 +2,11 @@ package fetcher
 
 import (
 	"context"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/dedup"
+	"github.com/Frozelo/FeedBackManagerBot/internal/filter"
 	"github.com/Frozelo/FeedBackManagerBot/internal/model"
-	"github.com/Frozelo/FeedBackManagerBot/internal/rss"
+	"github.com/Frozelo/FeedBackManagerBot/internal/sanitize"
 	"log"
 	"sync"
 	"time"
@@ -11,10 +14,25 @@ import (
 
 type SourceRepo interface {
 	Sources(ctx context.Context) ([]models.Source, error)
+	DueSources(ctx context.Context, now time.Time) ([]models.Source, error)
+	SetValidators(ctx context.Context, sourceID int64, etag, lastModified string) error
+	SetSchedule(ctx context.Context, sourceID int64, interval time.Duration, nextFetchAt time.Time) error
+	RecordSuccess(ctx context.Context, sourceID int64, latency time.Duration) error
+	RecordFailure(ctx context.Context, sourceID int64, reason string, latency time.Duration) (int, error)
+	Disable(ctx context.Context, sourceID int64) error
+	Source(ctx context.Context, sourceID int64) (models.Source, error)
+	SetWebSubHub(ctx context.Context, sourceID int64, hub, topic string) error
 }
 
 type ArticleRepo interface {
-	Add(ctx context.Context, article models.Article) error
+	AddBatch(ctx context.Context, articles []models.Article) (models.BatchResult, error)
+	RecentTitles(ctx context.Context, sourceID int64, since time.Time) ([]models.Article, error)
+	KnownLinks(ctx context.Context, canonicalLinks []string) (map[string]bool, error)
+}
+
+// RunRecorder keeps the history of fetch runs.
+type RunRecorder interface {
+	Record(ctx context.Context, run models.FetchRun) error
 }
 
 type Sourcer interface {
@@ -23,14 +41,76 @@ type Sourcer interface {
 }
 
 type Fetcher struct {
-	sourceRepo     SourceRepo
-	articleRepo    ArticleRepo
-	fetchInterval  time.Duration
-	filterKeywords []string
+	sourceRepo    SourceRepo
+	articleRepo   ArticleRepo
+	fetchInterval time.Duration
+	filter        *filter.Filter
+	filterStats   *filter.Stats
+	limits        Limits
+	schedule      Schedule
+	hosts         *hostLimiter
+	metrics       metricsRecorder
+	registry      *Registry
+	health        Health
+	fullText      FullTextExtractor
+	dates         Dates
+	titles        Titles
+	runs          RunRecorder
+
+	inflightMu sync.Mutex
+	inflight   map[int64]*flight
 }
 
-func NewFetcher(sourcesRepo SourceRepo, articleRepo ArticleRepo, interval time.Duration, filterKeywords []string) *Fetcher {
-	return &Fetcher{sourceRepo: sourcesRepo, articleRepo: articleRepo, fetchInterval: interval, filterKeywords: filterKeywords}
+type Options struct {
+	Filter   *filter.Filter
+	Limits   Limits
+	Schedule Schedule
+	Health   Health
+	Dates    Dates
+	Titles   Titles
+	Runs     RunRecorder
+	// FullText fetches article pages for sources with full-text mode on.
+	FullText FullTextExtractor
+}
+
+type fetchJob struct {
+	source   models.Source
+	queuedAt time.Time
+}
+
+// NewFetcher creates a fetcher that checks for due sources every interval.
+// Each source is then polled on its own schedule.
+func NewFetcher(sourcesRepo SourceRepo, articleRepo ArticleRepo, interval time.Duration, registry *Registry, opts Options) *Fetcher {
+	limits := opts.Limits.withDefaults()
+	return &Fetcher{
+		sourceRepo:    sourcesRepo,
+		articleRepo:   articleRepo,
+		fetchInterval: interval,
+		filter:        opts.Filter,
+		filterStats:   filter.NewStats(),
+		limits:        limits,
+		schedule:      opts.Schedule.withDefaults(interval),
+		hosts:         newHostLimiter(limits.PerHostConcurrency, limits.PerHostDelay),
+		registry:      registry,
+		health:        opts.Health.withDefaults(),
+		fullText:      opts.FullText,
+		dates:         opts.Dates.withDefaults(),
+		titles:        opts.Titles.withDefaults(),
+		runs:          opts.Runs,
+		inflight:      make(map[int64]*flight),
+	}
+}
+
+// Metrics returns fetch duration and queue wait statistics accumulated
+// since the fetcher was created.
+func (f *Fetcher) Metrics() Metrics {
+	return f.metrics.snapshot()
+}
+
+// FilterStats returns how many items each keyword rule has dropped so far.
+// Per-source rules are reported as "<source name>/<rule name>".
+func (f *Fetcher) FilterStats() map[string]int64 {
+	return f.filterStats.Snapshot()
 }
 
 func (f *Fetcher) Start(ctx context.Context) error {
@@ -53,52 +133,326 @@ func (f *Fetcher) Start(ctx context.Context) error {
 	}
 }
 
-// TODO work with keywords
 func (f *Fetcher) Fetch(ctx context.Context) error {
-	sources, err := f.sourceRepo.Sources(ctx)
+	sources, err := f.sourceRepo.DueSources(ctx, time.Now())
 	if err != nil {
 		return err
 	}
-	var wg sync.WaitGroup
 
-	for _, source := range sources {
+	jobs := make(chan fetchJob)
+	cycle := &metricsRecorder{}
+	var wg sync.WaitGroup
+	for i := 0; i < min(f.limits.Concurrency, len(sources)); i++ {
 		wg.Add(1)
-		go f.fetchSource(ctx, source, &wg)
+		go f.worker(ctx, jobs, cycle, &wg)
+	}
+
+	started := time.Now()
+enqueue:
+	for _, source := range interleaveByHost(sources) {
+		select {
+		case jobs <- fetchJob{source: source, queuedAt: started}:
+		case <-ctx.Done():
+			break enqueue
+		}
 	}
+	close(jobs)
 	wg.Wait()
-	return nil
+
+	m := cycle.snapshot()
+	log.Printf("[INFO] fetched %d sources in %s: fetch avg %s max %s, queue wait avg %s max %s",
+		m.Fetch.Count, time.Since(started).Round(time.Millisecond),
+		m.Fetch.Avg().Round(time.Millisecond), m.Fetch.Max.Round(time.Millisecond),
+		m.QueueWait.Avg().Round(time.Millisecond), m.QueueWait.Max.Round(time.Millisecond),
+	)
+	return ctx.Err()
 }
 
-func (f *Fetcher) fetchSource(ctx context.Context, source models.Source, wg *sync.WaitGroup) {
+func (f *Fetcher) worker(ctx context.Context, jobs <-chan fetchJob, cycle *metricsRecorder, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	rssSource := rss.NewRSS(source)
-	items, err := rssSource.Fetch(ctx)
+	for job := range jobs {
+		release, err := f.hosts.acquire(ctx, hostOf(job.source.FeedURL))
+		if err != nil {
+			continue
+		}
+		queueWait := time.Since(job.queuedAt)
+
+		fetchStarted := time.Now()
+		f.fetchOnce(ctx, job.source.ID, false, func() models.FetchRun {
+			return f.fetchSource(ctx, job.source)
+		})
+		release()
+		fetchTime := time.Since(fetchStarted)
+
+		cycle.observe(queueWait, fetchTime)
+		f.metrics.observe(queueWait, fetchTime)
+	}
+}
+
+// interleaveByHost orders sources round-robin by host, so that workers
+// waiting on one busy host do not hold back sources from other hosts.
+func interleaveByHost(sources []models.Source) []models.Source {
+	byHost := make(map[string][]models.Source)
+	var hosts []string
+	for _, source := range sources {
+		host := hostOf(source.FeedURL)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], source)
+	}
+
+	ordered := make([]models.Source, 0, len(sources))
+	for len(ordered) < len(sources) {
+		for _, host := range hosts {
+			if queue := byHost[host]; len(queue) > 0 {
+				ordered = append(ordered, queue[0])
+				byHost[host] = queue[1:]
+			}
+		}
+	}
+	return ordered
+}
+
+func (f *Fetcher) fetchSource(ctx context.Context, source models.Source) models.FetchRun {
+	started := time.Now()
+	run := models.FetchRun{SourceID: source.ID, StartedAt: started.UTC()}
+	interval, err := f.ingest(ctx, source, &run)
+	latency := time.Since(started)
+	if ctx.Err() != nil {
+		run.Error = ctx.Err().Error()
+		return run
+	}
+
 	if err != nil {
-		log.Printf("[ERROR] failed to fetch items from source %q: %v", source.Name, err)
+		log.Printf("[ERROR] source %q: %v", source.Name, err)
+		run.Error = err.Error()
+		f.recordFailure(ctx, source, err, latency)
+	} else {
+		f.recordSuccess(ctx, source, latency)
+	}
+	f.reschedule(ctx, source, interval)
+
+	run.FinishedAt = started.Add(latency).UTC()
+	f.recordRun(ctx, source, run)
+	return run
+}
+
+func (f *Fetcher) recordRun(ctx context.Context, source models.Source, run models.FetchRun) {
+	if f.runs == nil {
 		return
 	}
-	if err := f.processItems(ctx, rssSource, items); err != nil {
-		log.Printf("[ERROR] failed to process items from source %q: %v", source.Name, err)
+	if err := f.runs.Record(ctx, run); err != nil {
+		log.Printf("[ERROR] failed to record fetch run of source %q: %v", source.Name, err)
 	}
 }
 
-func (f *Fetcher) processItems(ctx context.Context, rssSource Sourcer, items *[]models.Item) error {
+// ingest fetches, filters and stores the items of a source, filling in the
+// counters of run as it goes. It returns the interval to wait before the
+// next fetch, even when it fails.
+func (f *Fetcher) ingest(ctx context.Context, source models.Source, run *models.FetchRun) (time.Duration, error) {
+	interval := f.schedule.current(source)
+
+	sourceFilter, err := filter.New(source.Filters)
+	if err != nil {
+		return interval, fmt.Errorf("invalid keyword rules: %w", err)
+	}
+
+	sourcer, err := f.registry.New(source)
+	if err != nil {
+		return interval, err
+	}
+	items, err := sourcer.Fetch(ctx)
+	if reporter, ok := sourcer.(StatusReporter); ok {
+		run.HTTPStatus = reporter.StatusCode()
+	}
+	if err != nil {
+		return interval, fmt.Errorf("failed to fetch items: %w", err)
+	}
+
+	var hint time.Duration
+	if hinter, ok := sourcer.(RefreshHinter); ok {
+		hint = hinter.RefreshHint()
+	}
+	interval = f.schedule.next(source, *items, hint, time.Now())
+	f.recordHub(ctx, source, sourcer)
+	if err := f.store(ctx, source, sourcer, sourceFilter, items, run); err != nil {
+		return interval, err
+	}
+
+	// Validators are saved only once the items are stored, otherwise a 304 on
+	// the next run would hide the items we failed to process.
+	validator, ok := sourcer.(CacheValidator)
+	if !ok {
+		return interval, nil
+	}
+	if etag, lastModified := validator.Validators(); etag != source.ETag || lastModified != source.LastModified {
+		if err := f.sourceRepo.SetValidators(ctx, source.ID, etag, lastModified); err != nil {
+			log.Printf("[ERROR] failed to save cache validators for source %q: %v", source.Name, err)
+		}
+	}
+	return interval, nil
+}
+
+// store runs fetched or pushed items through sanitizing, keyword rules and
+// full-text extraction and saves them.
+func (f *Fetcher) store(ctx context.Context, source models.Source, sourcer Sourcer, sourceFilter *filter.Filter, items *[]models.Item, run *models.FetchRun) error {
+	run.Items = len(*items)
+	sanitizeItems(*items)
+	items = f.filterItems(source, sourceFilter, items)
+	run.Filtered = run.Items - len(*items)
+	f.extractFullText(ctx, source, *items)
+	result, err := f.processItems(ctx, sourcer, items)
+	run.New, run.Duplicates, run.TitleDuplicates = result.New, result.Duplicates, result.TitleDuplicates
+	if err != nil {
+		return fmt.Errorf("failed to process items: %w", err)
+	}
+	if result.New > 0 || result.Failed > 0 || result.TitleDuplicates > 0 {
+		log.Printf("[INFO] source %q: %d new, %d duplicate, %d similar title, %d failed articles",
+			source.Name, result.New, result.Duplicates, result.TitleDuplicates, result.Failed)
+	}
+	return nil
+}
+
+func (f *Fetcher) reschedule(ctx context.Context, source models.Source, interval time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err := f.sourceRepo.SetSchedule(ctx, source.ID, interval, time.Now().Add(interval)); err != nil {
+		log.Printf("[ERROR] failed to reschedule source %q: %v", source.Name, err)
+	}
+}
+
+func (f *Fetcher) filterItems(source models.Source, sourceFilter *filter.Filter, items *[]models.Item) *[]models.Item {
+	if f.filter.Empty() && sourceFilter.Empty() {
+		return items
+	}
+
+	kept := make([]models.Item, 0, len(*items))
+	dropped := 0
 	for _, item := range *items {
-		item.Date = item.Date.UTC()
+		if ok, rule := f.filter.Match(item); !ok {
+			f.filterStats.Inc(rule)
+			dropped++
+			continue
+		}
+		if ok, rule := sourceFilter.Match(item); !ok {
+			f.filterStats.Inc(source.Name + "/" + rule)
+			dropped++
+			continue
+		}
+		kept = append(kept, item)
+	}
+
+	if dropped > 0 {
+		log.Printf("[INFO] keyword rules dropped %d of %d items from source %q (totals: %s)", dropped, len(*items), source.Name, f.filterStats)
+	}
+	return &kept
+}
+
+// sanitizeItems strips markup from plain-text fields and reduces summaries
+// and content to the safe HTML subset before anything else sees them.
+func sanitizeItems(items []models.Item) {
+	for i := range items {
+		item := &items[i]
+		item.Title = sanitize.Text(item.Title)
+		item.Author = sanitize.Text(item.Author)
+		item.Summary = sanitize.HTML(item.Summary)
+		item.Content = sanitize.HTML(item.Content)
+		for j, category := range item.Categories {
+			item.Categories[j] = sanitize.Text(category)
+		}
+	}
+}
+
+// otherTitles returns the titles of the known articles other than the
+// article itself. A re-polled feed brings back the items already stored;
+// those are left to the GUID and link dedup instead of matching their own
+// titles.
+func otherTitles(article models.Article, known []models.Article) []string {
+	titles := make([]string, 0, len(known))
+	for _, other := range known {
+		if article.CanonicalLink != "" && other.CanonicalLink == article.CanonicalLink {
+			continue
+		}
+		if article.GUID != "" && other.GUID == article.GUID {
+			continue
+		}
+		titles = append(titles, other.Title)
+	}
+	return titles
+}
+
+func (f *Fetcher) processItems(ctx context.Context, sourcer Sourcer, items *[]models.Item) (models.BatchResult, error) {
+	// Titles are only compared within one host, so a source that
+	// aggregates several sites does not drop one site's article for
+	// another's.
+	recent := make(map[string][]models.Article)
+	if !f.titles.Disabled {
+		stored, err := f.articleRepo.RecentTitles(ctx, sourcer.Id(), time.Now().Add(-f.titles.Window))
+		if err != nil {
+			return models.BatchResult{}, err
+		}
+		for _, article := range stored {
+			host := dedup.Host(article.CanonicalLink)
+			recent[host] = append(recent[host], article)
+		}
+	}
+
+	firstSeen := time.Now().UTC()
+	articles := make([]models.Article, 0, len(*items))
+	similar, undated := 0, 0
+	for _, item := range *items {
+		publishedAt, ok := f.dates.effective(item.Date, firstSeen)
+		if !ok {
+			undated++
+		}
 
 		article := models.Article{
-			Title: item.Title,
-			// TODO implement source logic
-			SourceID:    rssSource.Id(),
-			Link:        item.Link,
-			Categories:  item.Categories,
-			PublishedAt: item.Date,
+			SourceID:      sourcer.Id(),
+			GUID:          item.GUID,
+			Title:         item.Title,
+			Link:          item.Link,
+			CanonicalLink: dedup.CanonicalURL(item.Link),
 		}
-		if err := f.articleRepo.Add(ctx, article); err != nil {
-			return err
+		if !f.titles.Disabled {
+			host := dedup.Host(article.CanonicalLink)
+			if match, ok := dedup.SimilarTitle(item.Title, otherTitles(article, recent[host]), f.titles.Threshold); ok {
+				log.Printf("[INFO] source %d: dropped %q (%s) as a re-publication of %q", sourcer.Id(), item.Title, item.Link, match)
+				similar++
+				continue
+			}
+			recent[host] = append(recent[host], article)
 		}
+
+		articles = append(articles, models.Article{
+			SourceID:      article.SourceID,
+			GUID:          article.GUID,
+			Title:         article.Title,
+			Link:          article.Link,
+			CanonicalLink: article.CanonicalLink,
+			Summary:       item.Summary,
+			Content:       item.Content,
+			Author:        item.Author,
+			Categories:    item.Categories,
+			Enclosures:    item.Enclosures,
+			ImageURL:      item.ImageURL,
+			PublishedAt:   publishedAt,
+			FirstSeenAt:   firstSeen,
+		})
+	}
+	if undated > 0 {
+		log.Printf("[INFO] source %d: %d items without a plausible date, using first-seen time", sourcer.Id(), undated)
 	}
 
-	return nil
+	result, err := f.articleRepo.AddBatch(ctx, articles)
+	if err != nil {
+		return result, err
+	}
+	result.TitleDuplicates = similar
+	for _, err := range result.Errors {
+		log.Printf("[ERROR] failed to store article from source %d: %v", sourcer.Id(), err)
+	}
+	return result, nil
 }
@@ -0,0 +1,108 @@
+package fetcher
+
+import (
+	"context"
+	"github.com/Frozelo/FeedBackManagerBot/internal/dedup"
+	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"testing"
+	"time"
+)
+
+// fakeArticles stores articles like the articles table: a GUID or
+// canonical link seen before makes the row a duplicate.
+type fakeArticles struct {
+	stored []models.Article
+}
+
+func (r *fakeArticles) AddBatch(_ context.Context, articles []models.Article) (models.BatchResult, error) {
+	var result models.BatchResult
+	for _, article := range articles {
+		if r.known(article) {
+			result.Duplicates++
+			continue
+		}
+		r.stored = append(r.stored, article)
+		result.New++
+	}
+	return result, nil
+}
+
+func (r *fakeArticles) known(article models.Article) bool {
+	for _, other := range r.stored {
+		if article.GUID != "" && other.GUID == article.GUID {
+			return true
+		}
+		if article.CanonicalLink != "" && other.CanonicalLink == article.CanonicalLink {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeArticles) RecentTitles(context.Context, int64, time.Time) ([]models.Article, error) {
+	return r.stored, nil
+}
+
+func (r *fakeArticles) KnownLinks(_ context.Context, canonicalLinks []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	for _, link := range canonicalLinks {
+		known[link] = r.known(models.Article{CanonicalLink: dedup.CanonicalURL(link)})
+	}
+	return known, nil
+}
+
+type fakeSourcer struct{}
+
+func (fakeSourcer) Fetch(context.Context) (*[]models.Item, error) { return nil, nil }
+func (fakeSourcer) Id() int64                                     { return 1 }
+
+func TestProcessItemsRepoll(t *testing.T) {
+	repo := &fakeArticles{}
+	f := NewFetcher(nil, repo, time.Minute, NewRegistry(), Options{})
+	items := []models.Item{
+		{GUID: "1", Title: "Go 1.22 is released with range over integers", Link: "https://blog.example/go-1-22"},
+		{Title: "A scraped page has no GUID at all", Link: "https://blog.example/scraped"},
+		{GUID: "3", Title: "Курс валют на 12 марта", Link: "https://blog.example/rates-12"},
+	}
+
+	first, err := f.processItems(context.Background(), fakeSourcer{}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.New != 3 || first.Duplicates != 0 || first.TitleDuplicates != 0 {
+		t.Errorf("first poll: %+v, want 3 new", first)
+	}
+
+	// An unchanged feed polled again brings only known items, which are
+	// duplicates and not re-publications of themselves.
+	again := append([]models.Item(nil), items...)
+	second, err := f.processItems(context.Background(), fakeSourcer{}, &again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.New != 0 || second.Duplicates != 3 || second.TitleDuplicates != 0 {
+		t.Errorf("re-poll: %+v, want 3 duplicates and no similar titles", second)
+	}
+}
+
+func TestProcessItemsRepublication(t *testing.T) {
+	repo := &fakeArticles{}
+	f := NewFetcher(nil, repo, time.Minute, NewRegistry(), Options{})
+	items := []models.Item{{GUID: "1", Title: "Go 1.22 is released with range over integers", Link: "https://blog.example/go-1-22"}}
+	if _, err := f.processItems(context.Background(), fakeSourcer{}, &items); err != nil {
+		t.Fatal(err)
+	}
+
+	items = []models.Item{
+		{GUID: "2", Title: "Go 1.22 is released with range over integers!", Link: "https://blog.example/go-1-22-again"},
+		{GUID: "3", Title: "Go 1.22 is released with range over integers", Link: "https://mirror.example/go-1-22"},
+	}
+	result, err := f.processItems(context.Background(), fakeSourcer{}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The copy on another host is kept.
+	if result.New != 1 || result.TitleDuplicates != 1 {
+		t.Errorf("got %+v, want 1 new and 1 similar title", result)
+	}
+}
@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"github.com/Frozelo/FeedBackManagerBot/internal/dedup"
+	"github.com/Frozelo/FeedBackManagerBot/internal/extract"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/sanitize"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxExtractionsPerFetch bounds the page downloads of a single fetch;
+	// the rest of a large backlog is stored with the feed content only.
+	maxExtractionsPerFetch = 20
+	// summaryLength is the size of a summary made from extracted text.
+	summaryLength = 300
+)
+
+type FullTextExtractor interface {
+	Extract(ctx context.Context, source models.Source, pageURL string) (extract.Result, error)
+}
+
+// extractFullText replaces the teasers of a full-text source with the
+// article text from the linked pages. Items already stored are skipped so
+// their pages are not downloaded on every fetch.
+func (f *Fetcher) extractFullText(ctx context.Context, source models.Source, items []models.Item) {
+	if f.fullText == nil || !source.Options.FullText || len(items) == 0 {
+		return
+	}
+
+	links := make([]string, 0, len(items))
+	for _, item := range items {
+		links = append(links, dedup.CanonicalURL(item.Link))
+	}
+	known, err := f.articleRepo.KnownLinks(ctx, links)
+	if err != nil {
+		log.Printf("[ERROR] failed to look up known articles for source %q: %v", source.Name, err)
+		return
+	}
+
+	extracted, failed := 0, 0
+	for i := range items {
+		item := &items[i]
+		if item.Link == "" || known[links[i]] {
+			continue
+		}
+		if extracted+failed >= maxExtractionsPerFetch || ctx.Err() != nil {
+			break
+		}
+
+		result, err := f.fullText.Extract(ctx, source, item.Link)
+		if err != nil {
+			failed++
+			if !errors.Is(err, extract.ErrNoContent) {
+				log.Printf("[ERROR] failed to extract %q for source %q: %v", item.Link, source.Name, err)
+			}
+			continue
+		}
+		extracted++
+
+		if content := sanitize.HTML(result.Content); content != "" {
+			item.Content = content
+		}
+		if item.ImageURL == "" {
+			item.ImageURL = result.Image
+		}
+		if item.Author == "" {
+			item.Author = sanitize.Text(result.Byline)
+		}
+		if sanitize.Text(item.Summary) == "" {
+			item.Summary = excerpt(sanitize.Text(item.Content), summaryLength)
+		}
+	}
+
+	if extracted > 0 || failed > 0 {
+		log.Printf("[INFO] source %q: extracted full text of %d articles, %d failed", source.Name, extracted, failed)
+	}
+}
+
+// excerpt cuts text to at most n bytes on a word boundary.
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= n {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:n], ' ')
+	if cut <= 0 {
+		cut = n
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return text[:cut] + "…"
+}
@@ -0,0 +1,72 @@
+package fetcher
+
+import (
+	"context"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"log"
+	"time"
+)
+
+// HealthAlerter is told when a source gets disabled after failing too many
+// times in a row.
+type HealthAlerter interface {
+	SourceDisabled(ctx context.Context, source models.Source, failures int, reason error) error
+}
+
+const (
+	defaultMaxFailures = 10
+	// alertTimeout bounds how long the alert about a disabled source may
+	// wait in the outbox.
+	alertTimeout = 10 * time.Minute
+)
+
+type Health struct {
+	// MaxFailures is the number of consecutive failures after which a source
+	// is disabled, 10 when unset. A negative value keeps failing sources
+	// enabled.
+	MaxFailures int
+	Alerter     HealthAlerter
+}
+
+func (h Health) withDefaults() Health {
+	if h.MaxFailures == 0 {
+		h.MaxFailures = defaultMaxFailures
+	}
+	return h
+}
+
+func (f *Fetcher) recordSuccess(ctx context.Context, source models.Source, latency time.Duration) {
+	if err := f.sourceRepo.RecordSuccess(ctx, source.ID, latency); err != nil {
+		log.Printf("[ERROR] failed to record success of source %q: %v", source.Name, err)
+	}
+}
+
+func (f *Fetcher) recordFailure(ctx context.Context, source models.Source, fetchErr error, latency time.Duration) {
+	failures, err := f.sourceRepo.RecordFailure(ctx, source.ID, fetchErr.Error(), latency)
+	if err != nil {
+		log.Printf("[ERROR] failed to record failure of source %q: %v", source.Name, err)
+		return
+	}
+	if f.health.MaxFailures <= 0 || failures < f.health.MaxFailures {
+		return
+	}
+
+	if err := f.sourceRepo.Disable(ctx, source.ID); err != nil {
+		log.Printf("[ERROR] failed to disable source %q: %v", source.Name, err)
+		return
+	}
+	log.Printf("[WARN] source %q disabled after %d consecutive failures", source.Name, failures)
+
+	if f.health.Alerter == nil {
+		return
+	}
+	// The alert waits its turn in the outbox; the worker does not hold its
+	// host slot meanwhile.
+	alertCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertTimeout)
+	go func() {
+		defer cancel()
+		if err := f.health.Alerter.SourceDisabled(alertCtx, source, failures, fetchErr); err != nil {
+			log.Printf("[ERROR] failed to alert about disabled source %q: %v", source.Name, err)
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package fetcher
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConcurrency        = 16
+	defaultPerHostConcurrency = 2
+)
+
+type Limits struct {
+	// Concurrency is the number of sources fetched at the same time.
+	Concurrency int
+	// PerHostConcurrency caps simultaneous requests to a single host.
+	PerHostConcurrency int
+	// PerHostDelay is the minimum gap between two requests to a single host.
+	PerHostDelay time.Duration
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.Concurrency <= 0 {
+		l.Concurrency = defaultConcurrency
+	}
+	if l.PerHostConcurrency <= 0 {
+		l.PerHostConcurrency = defaultPerHostConcurrency
+	}
+	return l
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	mu   sync.Mutex
+	next time.Time
+}
+
+// hostLimiter keeps the fetcher polite towards hosts serving many feeds.
+type hostLimiter struct {
+	mu            sync.Mutex
+	hosts         map[string]*hostSlot
+	maxConcurrent int
+	minDelay      time.Duration
+}
+
+func newHostLimiter(maxConcurrent int, minDelay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		hosts:         make(map[string]*hostSlot),
+		maxConcurrent: maxConcurrent,
+		minDelay:      minDelay,
+	}
+}
+
+func (l *hostLimiter) slot(host string) *hostSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{sem: make(chan struct{}, l.maxConcurrent)}
+		l.hosts[host] = slot
+	}
+	return slot
+}
+
+// acquire blocks until a request to host is allowed and returns the func
+// that gives the slot back.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	slot := l.slot(host)
+	select {
+	case slot.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slot.sem }
+
+	if l.minDelay <= 0 {
+		return release, nil
+	}
+
+	slot.mu.Lock()
+	now := time.Now()
+	start := now
+	if slot.next.After(now) {
+		start = slot.next
+	}
+	slot.next = start.Add(l.minDelay)
+	slot.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+type DurationStat struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+func (s *DurationStat) observe(d time.Duration) {
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+func (s DurationStat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Metrics describes where time goes during fetching: QueueWait is the
+// time a source spent waiting for a worker and its host slot, Fetch is the
+// time spent fetching and storing it.
+type Metrics struct {
+	QueueWait DurationStat
+	Fetch     DurationStat
+}
+
+type metricsRecorder struct {
+	mu      sync.Mutex
+	metrics Metrics
+}
+
+func (r *metricsRecorder) observe(queueWait, fetch time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics.QueueWait.observe(queueWait)
+	r.metrics.Fetch.observe(fetch)
+}
+
+func (r *metricsRecorder) snapshot() Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metrics
+}
@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/filter"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"log"
+	"time"
+)
+
+// Push stores content a WebSub hub delivered for a source. It goes through
+// the same steps as a polled fetch and is recorded as a fetch run.
+func (f *Fetcher) Push(ctx context.Context, sourceID int64, body []byte) error {
+	started := time.Now()
+	source, err := f.sourceRepo.Source(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	run := models.FetchRun{SourceID: source.ID, StartedAt: started.UTC()}
+	err = f.ingestPush(ctx, source, body, &run)
+	if err != nil {
+		log.Printf("[ERROR] source %q: pushed content: %v", source.Name, err)
+		run.Error = "push: " + err.Error()
+	}
+	run.FinishedAt = time.Now().UTC()
+	f.recordRun(ctx, source, run)
+	return err
+}
+
+func (f *Fetcher) ingestPush(ctx context.Context, source models.Source, body []byte, run *models.FetchRun) error {
+	sourceFilter, err := filter.New(source.Filters)
+	if err != nil {
+		return fmt.Errorf("invalid keyword rules: %w", err)
+	}
+	sourcer, err := f.registry.New(source)
+	if err != nil {
+		return err
+	}
+	parser, ok := sourcer.(PushParser)
+	if !ok {
+		return fmt.Errorf("source type %q does not accept pushed content", source.Type)
+	}
+	items, err := parser.ParsePush(body)
+	if err != nil {
+		return fmt.Errorf("failed to parse pushed content: %w", err)
+	}
+	return f.store(ctx, source, sourcer, sourceFilter, items, run)
+}
+
+// recordHub saves the WebSub hub a feed advertises, so the subscriber can
+// pick it up.
+func (f *Fetcher) recordHub(ctx context.Context, source models.Source, sourcer Sourcer) {
+	advertiser, ok := sourcer.(HubAdvertiser)
+	if !ok {
+		return
+	}
+	hub, topic, ok := advertiser.Hub()
+	if hub == "" {
+		topic = ""
+	}
+	if !ok || (hub == source.WebSub.Hub && topic == source.WebSub.Topic) {
+		return
+	}
+	if err := f.sourceRepo.SetWebSubHub(ctx, source.ID, hub, topic); err != nil {
+		log.Printf("[ERROR] failed to save WebSub hub of source %q: %v", source.Name, err)
+	}
+}
@@ -0,0 +1,108 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"sync"
+)
+
+// flight is a fetch of one source in progress; others asking for the same
+// source wait on done and share run.
+type flight struct {
+	done chan struct{}
+	run  models.FetchRun
+}
+
+// fetchOnce runs fetch unless the source is already being fetched. With
+// join the caller then waits for the running fetch and gets its run;
+// without it fetchOnce returns at once and reports false.
+func (f *Fetcher) fetchOnce(ctx context.Context, sourceID int64, join bool, fetch func() models.FetchRun) (models.FetchRun, bool) {
+	f.inflightMu.Lock()
+	if running, ok := f.inflight[sourceID]; ok {
+		f.inflightMu.Unlock()
+		if !join {
+			return models.FetchRun{}, false
+		}
+		select {
+		case <-running.done:
+			return running.run, true
+		case <-ctx.Done():
+			return models.FetchRun{SourceID: sourceID, Error: ctx.Err().Error()}, false
+		}
+	}
+	current := &flight{done: make(chan struct{})}
+	f.inflight[sourceID] = current
+	f.inflightMu.Unlock()
+
+	defer func() {
+		f.inflightMu.Lock()
+		delete(f.inflight, sourceID)
+		f.inflightMu.Unlock()
+		close(current.done)
+	}()
+	current.run = fetch()
+	return current.run, true
+}
+
+// RefreshSource fetches a source right away, outside its schedule. If the
+// source is being fetched already, the result of that fetch is returned.
+func (f *Fetcher) RefreshSource(ctx context.Context, sourceID int64) (models.FetchRun, error) {
+	source, err := f.sourceRepo.Source(ctx, sourceID)
+	if err != nil {
+		return models.FetchRun{}, err
+	}
+	if source.Health.Disabled {
+		return models.FetchRun{}, fmt.Errorf("source %q is disabled", source.Name)
+	}
+	return f.refresh(ctx, source), ctx.Err()
+}
+
+// RefreshAll fetches every enabled source right away.
+func (f *Fetcher) RefreshAll(ctx context.Context) ([]models.FetchRun, error) {
+	sources, err := f.sourceRepo.Sources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make([]models.Source, 0, len(sources))
+	for _, source := range sources {
+		if !source.Health.Disabled {
+			enabled = append(enabled, source)
+		}
+	}
+	enabled = interleaveByHost(enabled)
+
+	runs := make([]models.FetchRun, len(enabled))
+	slots := make(chan struct{}, f.limits.Concurrency)
+	var wg sync.WaitGroup
+	for i, source := range enabled {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return runs[:i], ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, source models.Source) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			runs[i] = f.refresh(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+	return runs, ctx.Err()
+}
+
+// refresh takes the host slot only once it leads the fetch, so callers
+// joining a running fetch do not hold slots of their own.
+func (f *Fetcher) refresh(ctx context.Context, source models.Source) models.FetchRun {
+	run, _ := f.fetchOnce(ctx, source.ID, true, func() models.FetchRun {
+		release, err := f.hosts.acquire(ctx, hostOf(source.FeedURL))
+		if err != nil {
+			return models.FetchRun{SourceID: source.ID, Error: err.Error()}
+		}
+		defer release()
+		return f.fetchSource(ctx, source)
+	})
+	return run
+}
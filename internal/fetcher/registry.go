@@ -0,0 +1,86 @@
+package fetcher
+
+import (
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheValidator is implemented by sourcers that support conditional
+// requests; the validators are persisted after a successful fetch.
+type CacheValidator interface {
+	Validators() (etag, lastModified string)
+}
+
+// RefreshHinter is implemented by sourcers whose content suggests a
+// polling interval, such as RSS <ttl>.
+type RefreshHinter interface {
+	RefreshHint() time.Duration
+}
+
+// StatusReporter is implemented by sourcers that fetch over HTTP; it
+// returns the status of the latest response, or zero if there was none.
+type StatusReporter interface {
+	StatusCode() int
+}
+
+// HubAdvertiser is implemented by sourcers whose feeds can name a WebSub
+// hub. ok is false when the latest fetch did not reveal the links.
+type HubAdvertiser interface {
+	Hub() (hub, topic string, ok bool)
+}
+
+// PushParser is implemented by sourcers that can read content pushed by a
+// WebSub hub.
+type PushParser interface {
+	ParsePush(body []byte) (*[]models.Item, error)
+}
+
+type SourcerFactory func(source models.Source) (Sourcer, error)
+
+// Registry maps source types to the factories that build their sourcers.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]SourcerFactory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]SourcerFactory)}
+}
+
+func (r *Registry) Register(sourceType string, factory SourcerFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[sourceType] = factory
+}
+
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.factories))
+	for sourceType := range r.factories {
+		types = append(types, sourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New builds the sourcer for a source. Sources without a type are treated
+// as RSS.
+func (r *Registry) New(source models.Source) (Sourcer, error) {
+	sourceType := source.Type
+	if sourceType == "" {
+		sourceType = models.SourceTypeRSS
+	}
+
+	r.mu.RLock()
+	factory, ok := r.factories[sourceType]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q (registered: %s)", sourceType, strings.Join(r.Types(), ", "))
+	}
+	return factory(source)
+}
@@ -0,0 +1,125 @@
+package fetcher
+
+import (
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"sort"
+	"time"
+)
+
+const (
+	defaultMinInterval  = 5 * time.Minute
+	defaultMaxInterval  = 24 * time.Hour
+	defaultPushInterval = 6 * time.Hour
+
+	// scheduleSample is how many of the newest item dates are used to
+	// estimate how often a feed publishes.
+	scheduleSample = 20
+)
+
+type Schedule struct {
+	// Default is the interval for sources that have not been polled yet.
+	Default time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	// Push is the fallback polling interval for sources a WebSub hub
+	// pushes to.
+	Push time.Duration
+}
+
+func (s Schedule) withDefaults(fallback time.Duration) Schedule {
+	if s.Min <= 0 {
+		s.Min = defaultMinInterval
+	}
+	if s.Max <= 0 {
+		s.Max = defaultMaxInterval
+	}
+	if s.Push <= 0 {
+		s.Push = defaultPushInterval
+	}
+	if s.Default <= 0 {
+		s.Default = fallback
+	}
+	s.Default = s.clamp(s.Default)
+	return s
+}
+
+func (s Schedule) clamp(d time.Duration) time.Duration {
+	if d < s.Min {
+		return s.Min
+	}
+	if d > s.Max {
+		return s.Max
+	}
+	return d
+}
+
+// current returns the interval the source is being polled at right now.
+func (s Schedule) current(source models.Source) time.Duration {
+	if source.PinnedInterval > 0 {
+		return source.PinnedInterval
+	}
+	if source.FetchInterval > 0 {
+		return source.FetchInterval
+	}
+	return s.Default
+}
+
+// next picks the polling interval after a successful fetch. The target is
+// half the average gap between the newest items, stretched for feeds that
+// have gone quiet and backed off when there is nothing to learn from. The
+// result is smoothed against the current interval, never shorter than the
+// feed's own hint, no shorter than Push while a WebSub hub pushes the feed,
+// and always within [Min, Max]. Pinned intervals win.
+func (s Schedule) next(source models.Source, items []models.Item, hint time.Duration, now time.Time) time.Duration {
+	if source.PinnedInterval > 0 {
+		return source.PinnedInterval
+	}
+
+	current := s.current(source)
+	var target time.Duration
+	if len(items) == 0 {
+		target = current * 5 / 4
+	} else if gap, sinceNewest, ok := publishGap(items, now); ok {
+		target = gap / 2
+		if sinceNewest > 2*gap {
+			target = sinceNewest / 4
+		}
+	} else {
+		target = current * 3 / 2
+	}
+
+	interval := (current + target) / 2
+	if interval < hint {
+		interval = hint
+	}
+	if source.WebSub.Active(now) && interval < s.Push {
+		interval = s.Push
+	}
+	return s.clamp(interval)
+}
+
+// publishGap returns the average gap between the newest dated items and the
+// time since the newest one was published.
+func publishGap(items []models.Item, now time.Time) (gap, sinceNewest time.Duration, ok bool) {
+	dates := make([]time.Time, 0, len(items))
+	for _, item := range items {
+		if item.Date.IsZero() || item.Date.After(now) {
+			continue
+		}
+		dates = append(dates, item.Date)
+	}
+	if len(dates) < 2 {
+		return 0, 0, false
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].After(dates[j]) })
+	if len(dates) > scheduleSample {
+		dates = dates[:scheduleSample]
+	}
+
+	span := dates[0].Sub(dates[len(dates)-1])
+	if span <= 0 {
+		return 0, 0, false
+	}
+	return span / time.Duration(len(dates)-1), now.Sub(dates[0]), true
+}
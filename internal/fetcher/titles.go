@@ -0,0 +1,30 @@
+package fetcher
+
+import (
+	"time"
+)
+
+const (
+	defaultTitleThreshold = 0.85
+	defaultTitleWindow    = 72 * time.Hour
+)
+
+// Titles controls the re-publication check: an item whose title has a
+// Jaccard similarity of at least Threshold with an article stored for the
+// same source and host within Window is dropped. Disabled turns the check
+// off.
+type Titles struct {
+	Threshold float64
+	Window    time.Duration
+	Disabled  bool
+}
+
+func (t Titles) withDefaults() Titles {
+	if t.Threshold <= 0 || t.Threshold > 1 {
+		t.Threshold = defaultTitleThreshold
+	}
+	if t.Window <= 0 {
+		t.Window = defaultTitleWindow
+	}
+	return t
+}
@@ -0,0 +1,286 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// node is a compiled boolean keyword expression.
+type node interface {
+	eval(m *matcher) bool
+}
+
+type termNode struct {
+	term string
+}
+
+func (n termNode) eval(m *matcher) bool {
+	return m.contains(n.term)
+}
+
+type notNode struct {
+	expr node
+}
+
+func (n notNode) eval(m *matcher) bool {
+	return !n.expr.eval(m)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(m *matcher) bool {
+	return n.left.eval(m) && n.right.eval(m)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(m *matcher) bool {
+	return n.left.eval(m) || n.right.eval(m)
+}
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// tokenize splits an expression into terms, operators and parentheses.
+// Operators are recognised only in upper case, so "and" is a plain term.
+// Double quotes group a phrase into a single term.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			if strings.TrimSpace(string(runes[i+1:end])) == "" {
+				return nil, fmt.Errorf("empty phrase at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokTerm, value: string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokAnd})
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot})
+			default:
+				tokens = append(tokens, token{kind: tokTerm, value: word})
+			}
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser implements the grammar
+//
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary | "NOT" unary }
+//	unary   = "NOT" unary | primary
+//	primary = term | "(" or ")"
+//
+// Adjacent terms are joined with AND, and a NOT between two operands means
+// AND NOT, so `go AND (release OR security) NOT beta` reads naturally.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token at position %d", p.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokOr {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok {
+			return left, nil
+		}
+		switch tok.kind {
+		case tokAnd:
+			p.pos++
+		case tokNot, tokTerm, tokLParen:
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok, ok := p.peek()
+	if ok && tok.kind == tokNot {
+		p.pos++
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	switch tok.kind {
+	case tokTerm:
+		p.pos++
+		return termNode{term: tok.value}, nil
+	case tokLParen:
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.peek()
+		if !ok || closing.kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unexpected operator at position %d", p.pos)
+	}
+}
+
+// matcher answers term lookups against the text of a single item.
+type matcher struct {
+	text          string
+	caseSensitive bool
+	wholeWord     bool
+}
+
+func (m *matcher) contains(term string) bool {
+	if term == "" {
+		return false
+	}
+	if !m.caseSensitive {
+		term = strings.ToLower(term)
+	}
+	if !m.wholeWord {
+		return strings.Contains(m.text, term)
+	}
+
+	offset := 0
+	for offset < len(m.text) {
+		idx := strings.Index(m.text[offset:], term)
+		if idx < 0 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(term)
+		if isBoundary(m.text, start, true) && isBoundary(m.text, end, false) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+func isBoundary(text string, pos int, before bool) bool {
+	var r rune
+	if before {
+		if pos == 0 {
+			return true
+		}
+		r, _ = utf8.DecodeLastRuneInString(text[:pos])
+	} else {
+		if pos >= len(text) {
+			return true
+		}
+		r, _ = utf8.DecodeRuneInString(text[pos:])
+	}
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
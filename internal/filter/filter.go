@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/sanitize"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NoIncludeMatch is reported as the dropping rule when include rules are
+// configured and none of them matched the item.
+const NoIncludeMatch = "<no include rule matched>"
+
+type rule struct {
+	name          string
+	expr          node
+	caseSensitive bool
+	wholeWord     bool
+}
+
+type Filter struct {
+	include []rule
+	exclude []rule
+}
+
+func New(rules models.FilterRules) (*Filter, error) {
+	include, err := compile(rules.Include)
+	if err != nil {
+		return nil, fmt.Errorf("include rules: %w", err)
+	}
+	exclude, err := compile(rules.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude rules: %w", err)
+	}
+	return &Filter{include: include, exclude: exclude}, nil
+}
+
+func compile(rules []models.FilterRule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		expr, err := parse(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Expr, err)
+		}
+		name := r.Name
+		if name == "" {
+			name = r.Expr
+		}
+		compiled = append(compiled, rule{
+			name:          name,
+			expr:          expr,
+			caseSensitive: r.CaseSensitive,
+			wholeWord:     r.WholeWord,
+		})
+	}
+	return compiled, nil
+}
+
+func (f *Filter) Empty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0)
+}
+
+// Match reports whether the item passes the filter. Rules are matched
+// against the title, summary and categories. If the item is dropped, the
+// name of the responsible rule is returned as well.
+func (f *Filter) Match(item models.Item) (bool, string) {
+	if f.Empty() {
+		return true, ""
+	}
+
+	text := strings.Join(append([]string{item.Title, sanitize.Text(item.Summary)}, item.Categories...), "\n")
+	lower := strings.ToLower(text)
+	matches := func(r rule) bool {
+		m := &matcher{text: lower, wholeWord: r.wholeWord}
+		if r.caseSensitive {
+			m.text = text
+			m.caseSensitive = true
+		}
+		return r.expr.eval(m)
+	}
+
+	for _, r := range f.exclude {
+		if matches(r) {
+			return false, r.name
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true, ""
+	}
+	for _, r := range f.include {
+		if matches(r) {
+			return true, ""
+		}
+	}
+	return false, NoIncludeMatch
+}
+
+// Stats counts how many items each rule has dropped since start.
+type Stats struct {
+	mu      sync.Mutex
+	dropped map[string]int64
+}
+
+func NewStats() *Stats {
+	return &Stats{dropped: make(map[string]int64)}
+}
+
+func (s *Stats) Inc(rule string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[rule]++
+}
+
+func (s *Stats) Snapshot() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]int64, len(s.dropped))
+	for rule, count := range s.dropped {
+		snapshot[rule] = count
+	}
+	return snapshot
+}
+
+func (s *Stats) String() string {
+	snapshot := s.Snapshot()
+	rules := make([]string, 0, len(snapshot))
+	for rule := range snapshot {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	parts := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		parts = append(parts, fmt.Sprintf("%q=%d", rule, snapshot[rule]))
+	}
+	return strings.Join(parts, ", ")
+}
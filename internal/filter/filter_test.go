@@ -0,0 +1,200 @@
+package filter
+
+import (
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"strings"
+	"testing"
+)
+
+func evalExpr(t *testing.T, expr, text string, wholeWord bool) bool {
+	t.Helper()
+	n, err := parse(expr)
+	if err != nil {
+		t.Fatalf("parse(%q): %v", expr, err)
+	}
+	return n.eval(&matcher{text: strings.ToLower(text), wholeWord: wholeWord})
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		text string
+		want bool
+	}{
+		// AND binds tighter than OR: a OR (b AND c).
+		{"alpha OR beta AND gamma", "alpha", true},
+		{"alpha OR beta AND gamma", "beta", false},
+		{"alpha OR beta AND gamma", "beta gamma", true},
+		{"(alpha OR beta) AND gamma", "alpha", false},
+		{"(alpha OR beta) AND gamma", "alpha gamma", true},
+		// Adjacent terms are joined with AND.
+		{"alpha beta", "alpha", false},
+		{"alpha beta", "beta alpha", true},
+		// NOT binds to the next operand only.
+		{"NOT alpha beta", "beta", true},
+		{"NOT alpha beta", "alpha beta", false},
+		{"NOT (alpha beta)", "alpha", true},
+		{"NOT NOT alpha", "alpha", true},
+		// A NOT between operands means AND NOT.
+		{"go NOT beta", "go release", true},
+		{"go NOT beta", "go beta", false},
+		{"go AND (release OR security) NOT beta", "go security fix", true},
+		{"go AND (release OR security) NOT beta", "go release beta", false},
+		{"go AND (release OR security) NOT beta", "go news", false},
+		// Lower-case operators are plain terms.
+		{"alpha and beta", "alpha beta", false},
+		{"alpha and beta", "alpha and beta", true},
+	}
+	for _, tt := range tests {
+		if got := evalExpr(t, tt.expr, tt.text, false); got != tt.want {
+			t.Errorf("%q on %q = %v, want %v", tt.expr, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQuotedPhrases(t *testing.T) {
+	tests := []struct {
+		expr string
+		text string
+		want bool
+	}{
+		{`"open source"`, "a new open source tool", true},
+		{`"open source"`, "open the source", false},
+		{`"open source" NOT "closed beta"`, "open source in closed beta", false},
+		{`"AND"`, "this AND that", true},
+		{`"(a)"`, "see (a) above", true},
+		{`release"notes"`, "release notes", true},
+	}
+	for _, tt := range tests {
+		if got := evalExpr(t, tt.expr, tt.text, false); got != tt.want {
+			t.Errorf("%q on %q = %v, want %v", tt.expr, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWholeWord(t *testing.T) {
+	tests := []struct {
+		expr      string
+		text      string
+		wholeWord bool
+		want      bool
+	}{
+		{"кот", "Кот спит на диване", true, true},
+		{"кот", "Рецепт котлет", true, false},
+		{"кот", "Рецепт котлет", false, true},
+		{"кот", "Домашний скот", true, false},
+		{"кот", "кот, пёс и ёж", true, true},
+		{"ёж", "кот, пёс и ёж", true, true},
+		{"ёж", "ёжик", true, false},
+		{"выборы", "ВЫБОРЫ-2024: итоги", true, true},
+		{`"курс валют"`, "Курс валют на 12 марта", true, true},
+		{`"курс валют"`, "Курс валютный", true, false},
+		{"go", "Go 1.22 released", true, true},
+		{"go", "Google news", true, false},
+		{"go", "go_lang", true, false},
+		{"go", "go2", true, false},
+		{"x", "x", true, true},
+		{"x", "yx", true, false},
+	}
+	for _, tt := range tests {
+		if got := evalExpr(t, tt.expr, tt.text, tt.wholeWord); got != tt.want {
+			t.Errorf("%q on %q (whole word %v) = %v, want %v", tt.expr, tt.text, tt.wholeWord, got, tt.want)
+		}
+	}
+}
+
+// TestEmptyTerm guards the whole-word scan, which must stop at the end of
+// the text even for a term the parser would not produce.
+func TestEmptyTerm(t *testing.T) {
+	for _, text := range []string{"", "x", "кот"} {
+		if (&matcher{text: text, wholeWord: true}).contains("") {
+			t.Errorf("empty term matched %q as a whole word", text)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"   ",
+		"(alpha",
+		"alpha)",
+		"()",
+		"AND alpha",
+		"alpha OR",
+		"alpha AND",
+		"NOT",
+		"alpha OR OR beta",
+		`"unterminated`,
+		`alpha "beta`,
+		`""`,
+		`" "`,
+		`alpha OR ""`,
+	} {
+		if _, err := parse(expr); err == nil {
+			t.Errorf("parse(%q) accepted a malformed expression", expr)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	f, err := New(models.FilterRules{
+		Include: []models.FilterRule{
+			{Name: "go", Expr: "golang OR go", WholeWord: true},
+			{Expr: "Rust", CaseSensitive: true},
+		},
+		Exclude: []models.FilterRule{
+			{Name: "ads", Expr: `реклама OR "sponsored post"`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		item     models.Item
+		want     bool
+		wantRule string
+	}{
+		{"include by title", models.Item{Title: "Go 1.22 is out"}, true, ""},
+		{"include by category", models.Item{Title: "News", Categories: []string{"golang"}}, true, ""},
+		{"include by summary", models.Item{Title: "News", Summary: "<p>Written in <b>Go</b></p>"}, true, ""},
+		{"case-sensitive include", models.Item{Title: "Rust 2.0"}, true, ""},
+		{"case-sensitive miss", models.Item{Title: "rust on the car"}, false, NoIncludeMatch},
+		{"no include", models.Item{Title: "Google stock"}, false, NoIncludeMatch},
+		{"exclude wins", models.Item{Title: "Go tips", Summary: "Реклама"}, false, "ads"},
+		{"exclude phrase", models.Item{Title: "Go: a sponsored post"}, false, "ads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := f.Match(tt.item)
+			if got != tt.want || rule != tt.wantRule {
+				t.Errorf("Match() = %v, %q, want %v, %q", got, rule, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestNewRejectsMalformedRule(t *testing.T) {
+	_, err := New(models.FilterRules{Exclude: []models.FilterRule{{Expr: "(ads"}}})
+	if err == nil {
+		t.Fatal("New() accepted a malformed rule")
+	}
+	if !strings.Contains(err.Error(), "exclude rules") {
+		t.Errorf("error %q does not say which rules are wrong", err)
+	}
+}
+
+func TestEmptyPhraseRule(t *testing.T) {
+	if _, err := New(models.FilterRules{Include: []models.FilterRule{{Expr: `""`, WholeWord: true}}}); err == nil {
+		t.Fatal("New() accepted an empty phrase")
+	}
+}
+
+func TestEmptyFilter(t *testing.T) {
+	var f *Filter
+	if ok, _ := f.Match(models.Item{Title: "anything"}); !ok {
+		t.Error("nil filter dropped an item")
+	}
+}
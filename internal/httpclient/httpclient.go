@@ -0,0 +1,301 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultUserAgent      = "FeedManagerBot/1.0 (+https://github.com/Frozelo/FeedManagerBot)"
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+	defaultMaxBodySize    = 10 << 20
+	defaultMaxRedirects   = 5
+)
+
+var (
+	ErrBodyTooLarge = errors.New("response body too large")
+	// ErrPrivateAddress is returned by public clients for hosts that resolve
+	// to the bot's own network.
+	ErrPrivateAddress = errors.New("address is not public")
+)
+
+type Config struct {
+	UserAgent      string        `yaml:"userAgent"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	// ReadTimeout bounds the wait for response headers; the whole request
+	// may take at most ConnectTimeout + ReadTimeout.
+	ReadTimeout time.Duration `yaml:"readTimeout"`
+	// Proxy is an http://, https:// or socks5:// URL used for every source
+	// that does not set its own.
+	Proxy        string   `yaml:"proxy"`
+	MaxBodySize  int64    `yaml:"maxBodySize"`
+	MaxRedirects int      `yaml:"maxRedirects"`
+	CAFiles      []string `yaml:"caFiles"`
+	// AllowPrivate lets public clients reach private addresses too, for a
+	// bot that follows feeds on its own network.
+	AllowPrivate bool `yaml:"allowPrivate"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.UserAgent == "" {
+		c.UserAgent = defaultUserAgent
+	}
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = defaultConnectTimeout
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = defaultReadTimeout
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaultMaxBodySize
+	}
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = defaultMaxRedirects
+	}
+	return c
+}
+
+// Factory hands out HTTP clients for fetching feeds, one per proxy and
+// kind.
+type Factory struct {
+	cfg     Config
+	rootCAs *x509.CertPool
+
+	mu      sync.Mutex
+	clients map[clientKey]*http.Client
+}
+
+type clientKey struct {
+	proxy  string
+	public bool
+}
+
+func New(cfg Config) (*Factory, error) {
+	cfg = cfg.withDefaults()
+
+	var rootCAs *x509.CertPool
+	if len(cfg.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range cfg.CAFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %q", file)
+			}
+		}
+		rootCAs = pool
+	}
+
+	if _, err := parseProxy(cfg.Proxy); err != nil {
+		return nil, err
+	}
+
+	return &Factory{cfg: cfg, rootCAs: rootCAs, clients: make(map[clientKey]*http.Client)}, nil
+}
+
+// Client returns the client for a source proxy; an empty proxy means the
+// global one. It reaches any address, so it is only for endpoints the admin
+// set up; URLs from users or feeds go through PublicClient.
+func (f *Factory) Client(proxy string) (*http.Client, error) {
+	return f.client(proxy, false)
+}
+
+// PublicClient is like Client but for URLs that users type in. Without a
+// proxy it refuses to connect to loopback, private and link-local
+// addresses, so the bot cannot be used to probe its own network. With a
+// proxy the proxy makes the connections and has to enforce that itself.
+func (f *Factory) PublicClient(proxy string) (*http.Client, error) {
+	return f.client(proxy, true)
+}
+
+func (f *Factory) client(proxy string, public bool) (*http.Client, error) {
+	if proxy == "" {
+		proxy = f.cfg.Proxy
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := clientKey{proxy: proxy, public: public}
+	if client, ok := f.clients[key]; ok {
+		return client, nil
+	}
+
+	proxyURL, err := parseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := f.newClient(proxyURL, public)
+	f.clients[key] = client
+	return client, nil
+}
+
+func (f *Factory) newClient(proxyURL *url.URL, public bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   f.cfg.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	proxy := http.ProxyFromEnvironment
+	if public && proxyURL == nil && !f.cfg.AllowPrivate {
+		// Every dial goes to the target itself, so none may bypass the check
+		// through a proxy from the environment.
+		dialer.Control = checkPublic
+		proxy = nil
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   f.cfg.ConnectTimeout,
+		ResponseHeaderTimeout: f.cfg.ReadTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   4,
+		ForceAttemptHTTP2:     true,
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if f.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: f.rootCAs}
+	}
+
+	maxRedirects := f.cfg.MaxRedirects
+	return &http.Client{
+		Transport: &roundTripper{
+			next:        transport,
+			userAgent:   f.cfg.UserAgent,
+			maxBodySize: f.cfg.MaxBodySize,
+		},
+		Timeout: f.cfg.ConnectTimeout + f.cfg.ReadTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// checkPublic runs after the name is resolved and before the connection is
+// made, so a name that resolves differently on a second lookup gets no
+// chance to slip through.
+func checkPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip.Unmap())
+	}
+	return nil
+}
+
+// PublicURL reports whether a URL is an http or https URL whose host is not
+// obviously private: localhost or a private IP literal. Names are checked
+// only when a public client connects.
+func PublicURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return isPublic(ip)
+	}
+	return true
+}
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which IsPrivate leaves
+// out.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func parseProxy(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// roundTripper sets the User-Agent and caps the size of response bodies.
+type roundTripper struct {
+	next        http.RoundTripper
+	userAgent   string
+	maxBodySize int64
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", rt.userAgent)
+	}
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > rt.maxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes", ErrBodyTooLarge, resp.ContentLength)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: rt.maxBodySize}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Allow a clean EOF exactly at the limit.
+		var probe [1]byte
+		if n, err := b.ReadCloser.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
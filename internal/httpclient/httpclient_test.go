@@ -0,0 +1,98 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	clients, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := clients.PublicClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := public.Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("public client reached %s: %v", server.URL, err)
+	}
+
+	client, err := clients.Client("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("feed client failed: %v", err)
+	}
+	resp.Body.Close()
+
+	lan, err := New(Config{AllowPrivate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err = lan.PublicClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = public.Get(server.URL)
+	if err != nil {
+		t.Fatalf("public client with private addresses allowed failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestCheckPublic(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		if err := checkPublic("tcp", tt.address, nil); (err == nil) != tt.public {
+			t.Errorf("checkPublic(%q) = %v, want public %v", tt.address, err, tt.public)
+		}
+	}
+}
+
+func TestPublicURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		public bool
+	}{
+		{"https://blog.example/feed", true},
+		{"http://93.184.216.34/rss", true},
+		{"ftp://blog.example/feed", false},
+		{"http:///feed", false},
+		{"http://localhost:8080/feed", false},
+		{"http://LOCALHOST./feed", false},
+		{"http://127.0.0.1/feed", false},
+		{"http://10.0.0.5/feed", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[::1]/feed", false},
+	}
+	for _, tt := range tests {
+		if got := PublicURL(tt.url); got != tt.public {
+			t.Errorf("PublicURL(%q) = %v, want %v", tt.url, got, tt.public)
+		}
+	}
+}
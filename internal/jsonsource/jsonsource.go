@@ -0,0 +1,178 @@
+package jsonsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/dateparse"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type fieldPaths struct {
+	title, link, guid, date, summary, categories []segment
+}
+
+// JSONSource is a Sourcer for JSON APIs. The item array and the item
+// fields are located with the paths in the source options.
+type JSONSource struct {
+	URL      string
+	SourceId int64
+	Name     string
+
+	opts   models.JSONOptions
+	items  []segment
+	fields fieldPaths
+	client *http.Client
+	status int
+}
+
+func NewJSONSource(source models.Source, client *http.Client) (*JSONSource, error) {
+	opts := source.Options.JSON
+	if opts == nil || opts.Items == "" || opts.Title == "" || opts.Link == "" {
+		return nil, fmt.Errorf("source %q needs items, title and link paths", source.Name)
+	}
+
+	s := &JSONSource{
+		URL:      source.FeedURL,
+		SourceId: source.ID,
+		Name:     source.Name,
+		opts:     *opts,
+		client:   client,
+	}
+
+	var err error
+	compile := func(path string) []segment {
+		if path == "" || err != nil {
+			return nil
+		}
+		var segments []segment
+		segments, err = parsePath(path)
+		if err != nil {
+			err = fmt.Errorf("path %q: %w", path, err)
+		}
+		return segments
+	}
+	s.items = compile(opts.Items)
+	s.fields = fieldPaths{
+		title:      compile(opts.Title),
+		link:       compile(opts.Link),
+		guid:       compile(opts.GUID),
+		date:       compile(opts.Date),
+		summary:    compile(opts.Summary),
+		categories: compile(opts.Categories),
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONSource) Id() int64 {
+	return s.SourceId
+}
+
+// StatusCode returns the HTTP status of the latest response.
+func (s *JSONSource) StatusCode() int {
+	return s.status
+}
+
+func (s *JSONSource) Fetch(ctx context.Context) (*[]models.Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range s.opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	s.status = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var root any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	var rawItems []any
+	for _, value := range eval(root, s.items) {
+		if list, ok := value.([]any); ok {
+			rawItems = append(rawItems, list...)
+		} else {
+			rawItems = append(rawItems, value)
+		}
+	}
+	if len(rawItems) == 0 {
+		return nil, fmt.Errorf("path %q matched no items", s.opts.Items)
+	}
+
+	base := resp.Request.URL
+	items := make([]models.Item, 0, len(rawItems))
+	for _, raw := range rawItems {
+		if item, ok := s.createItem(raw, base); ok {
+			items = append(items, item)
+		}
+	}
+	return &items, nil
+}
+
+func (s *JSONSource) createItem(raw any, base *url.URL) (models.Item, bool) {
+	first := func(path []segment) string {
+		if path == nil {
+			return ""
+		}
+		values := stringValues(eval(raw, path))
+		if len(values) == 0 {
+			return ""
+		}
+		return strings.TrimSpace(values[0])
+	}
+
+	title := first(s.fields.title)
+	link := first(s.fields.link)
+	if ref, err := url.Parse(link); err == nil && link != "" {
+		link = base.ResolveReference(ref).String()
+	}
+	if title == "" || link == "" {
+		return models.Item{}, false
+	}
+
+	item := models.Item{
+		GUID:       first(s.fields.guid),
+		Title:      title,
+		Link:       link,
+		Summary:    first(s.fields.summary),
+		SourceName: s.Name,
+	}
+	if item.GUID == "" {
+		item.GUID = link
+	}
+	if s.fields.categories != nil {
+		item.Categories = stringValues(eval(raw, s.fields.categories))
+	}
+	if value := first(s.fields.date); value != "" {
+		if date, err := dateparse.Parse(value, s.opts.DateLayout); err == nil {
+			item.Date = date
+		}
+	}
+	return item, true
+}
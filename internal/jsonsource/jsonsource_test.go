@@ -0,0 +1,208 @@
+package jsonsource
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const apiResponse = `{
+	"data": {
+		"posts": [
+			{
+				"id": 1,
+				"attributes": {"title": "First post", "url": "/posts/1", "published": "2024-03-12T10:00:00Z"},
+				"excerpt": "Short text",
+				"tags": [{"name": "go"}, {"name": "rss"}]
+			},
+			{
+				"id": 2,
+				"attributes": {"title": "Second post", "url": "https://other.example/2"},
+				"tags": []
+			},
+			{
+				"id": 3,
+				"attributes": {"title": "", "url": "/posts/3"}
+			}
+		]
+	}
+}`
+
+func TestEval(t *testing.T) {
+	var root any
+	dec := json.NewDecoder(strings.NewReader(apiResponse))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"$.data.posts[0].attributes.title", []string{"First post"}},
+		{"data.posts[1].attributes.url", []string{"https://other.example/2"}},
+		{"$.data.posts[-1].id", []string{"3"}},
+		{`$["data"]["posts"][0].excerpt`, []string{"Short text"}},
+		{"$.data.posts[*].id", []string{"1", "2", "3"}},
+		{"$.data.posts[0].tags[*].name", []string{"go", "rss"}},
+		{"$.data.posts[7].id", nil},
+		{"$.data.missing", nil},
+	}
+	for _, tt := range tests {
+		segments, err := parsePath(tt.path)
+		if err != nil {
+			t.Fatalf("parsePath(%q): %v", tt.path, err)
+		}
+		if got := stringValues(eval(root, segments)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("eval(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePathError(t *testing.T) {
+	if _, err := parsePath("$.data.posts[0"); err == nil {
+		t.Error("parsePath accepted a path with a missing ]")
+	}
+}
+
+func newTestSource(t *testing.T, feedURL string, opts models.JSONOptions) *JSONSource {
+	t.Helper()
+	source, err := NewJSONSource(models.Source{
+		ID:      7,
+		Name:    "api",
+		Type:    models.SourceTypeJSON,
+		FeedURL: feedURL,
+		Options: models.SourceOptions{JSON: &opts},
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+var postOptions = models.JSONOptions{
+	Items:      "$.data.posts",
+	Title:      "attributes.title",
+	Link:       "attributes.url",
+	GUID:       "id",
+	Date:       "attributes.published",
+	Summary:    "excerpt",
+	Categories: "tags[*].name",
+	Headers:    map[string]string{"Authorization": "Bearer secret", "X-Api-Version": "2"},
+}
+
+func TestFetch(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(apiResponse))
+	}))
+	defer server.Close()
+
+	source := newTestSource(t, server.URL+"/api/posts", postOptions)
+	items, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := headers.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization header = %q", got)
+	}
+	if got := headers.Get("X-Api-Version"); got != "2" {
+		t.Errorf("X-Api-Version header = %q", got)
+	}
+	if got := headers.Get("Accept"); got != "application/json" {
+		t.Errorf("Accept header = %q", got)
+	}
+	if source.StatusCode() != http.StatusOK {
+		t.Errorf("StatusCode() = %d", source.StatusCode())
+	}
+
+	// The third post has no title and is skipped.
+	want := []models.Item{
+		{
+			GUID:       "1",
+			Title:      "First post",
+			Link:       server.URL + "/posts/1",
+			Date:       time.Date(2024, 3, 12, 10, 0, 0, 0, time.UTC),
+			Summary:    "Short text",
+			Categories: []string{"go", "rss"},
+			SourceName: "api",
+		},
+		{
+			GUID:       "2",
+			Title:      "Second post",
+			Link:       "https://other.example/2",
+			SourceName: "api",
+		},
+	}
+	if len(*items) != len(want) {
+		t.Fatalf("got %d items, want %d: %+v", len(*items), len(want), *items)
+	}
+	for i, item := range *items {
+		if !item.Date.Equal(want[i].Date) {
+			t.Errorf("item %d date = %v, want %v", i, item.Date, want[i].Date)
+		}
+		item.Date = want[i].Date
+		if !reflect.DeepEqual(item, want[i]) {
+			t.Errorf("item %d = %+v, want %+v", i, item, want[i])
+		}
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		items   string
+		wantErr string
+	}{
+		{"not json", http.StatusOK, "<html>not json</html>", "$.data.posts", "invalid json"},
+		{"no items", http.StatusOK, apiResponse, "$.data.articles", "matched no items"},
+		{"bad status", http.StatusInternalServerError, "", "$.data.posts", "unexpected status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			opts := postOptions
+			opts.Items = tt.items
+			_, err := newTestSource(t, server.URL, opts).Fetch(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Fetch() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewJSONSourceErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *models.JSONOptions
+	}{
+		{"no options", nil},
+		{"no title", &models.JSONOptions{Items: "items", Link: "url"}},
+		{"bad path", &models.JSONOptions{Items: "data[0", Title: "title", Link: "url"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJSONSource(models.Source{Name: "api", Options: models.SourceOptions{JSON: tt.opts}}, http.DefaultClient)
+			if err == nil {
+				t.Error("NewJSONSource() accepted invalid options")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package jsonsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath compiles a JSONPath-like expression: an optional leading "$",
+// dot-separated keys, [n] indexes and [*] wildcards, e.g. "$.data[0].items"
+// or "tags[*].name".
+func parsePath(path string) ([]segment, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	path = strings.TrimPrefix(path, ".")
+
+	var segments []segment
+	for path != "" {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in path")
+			}
+			inner := strings.Trim(path[1:end], `"' `)
+			path = path[end+1:]
+			if inner == "*" {
+				segments = append(segments, segment{wildcard: true})
+				continue
+			}
+			if n, err := strconv.Atoi(inner); err == nil {
+				segments = append(segments, segment{index: n, isIndex: true})
+				continue
+			}
+			segments = append(segments, segment{key: inner})
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			segments = append(segments, segment{key: path[:end]})
+			path = path[end:]
+		}
+	}
+	return segments, nil
+}
+
+// eval returns every value the path reaches from root.
+func eval(root any, segments []segment) []any {
+	values := []any{root}
+	for _, seg := range segments {
+		var next []any
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]any:
+				if seg.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[seg.key]; ok && !seg.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				switch {
+				case seg.wildcard:
+					next = append(next, v...)
+				case seg.isIndex:
+					i := seg.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// stringValues flattens the values reached by a path into strings; arrays
+// of scalars are expanded.
+func stringValues(values []any) []string {
+	var out []string
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			out = append(out, v)
+		case json.Number:
+			out = append(out, v.String())
+		case bool:
+			out = append(out, strconv.FormatBool(v))
+		case []any:
+			out = append(out, stringValues(v)...)
+		}
+	}
+	return out
+}
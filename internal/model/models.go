@@ -3,35 +3,248 @@ package models
 import "time"
 
 type Item struct {
+	GUID       string
 	Title      string
 	Categories []string
 	Link       string
 	Date       time.Time
 	Summary    string
+	Content    string
+	Author     string
+	Enclosures []Enclosure
+	ImageURL   string
 	SourceName string
 }
 
+type Enclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type"`
+	Length int64  `json:"length"`
+}
+
+const (
+	SourceTypeRSS  = "rss"
+	SourceTypeHTML = "html"
+	SourceTypeJSON = "json"
+)
+
 type Source struct {
-	ID        int64
-	Name      string
-	FeedURL   string
-	Priority  int
-	CreatedAt time.Time
+	ID       int64
+	Name     string
+	Type     string
+	FeedURL  string
+	Priority int
+	Filters  FilterRules
+	// Proxy overrides the global HTTP proxy for this source.
+	Proxy string
+	// Options holds the settings specific to the source type.
+	Options      SourceOptions
+	ETag         string
+	LastModified string
+	// FetchInterval is the current polling interval, PinnedInterval an
+	// admin-set override that disables adaptive scheduling when non-zero.
+	FetchInterval  time.Duration
+	PinnedInterval time.Duration
+	NextFetchAt    time.Time
+	Health         SourceHealth
+	WebSub         WebSub
+	CreatedAt      time.Time
+}
+
+type SourceHealth struct {
+	LastSuccessAt       time.Time
+	LastErrorAt         time.Time
+	LastError           string
+	ConsecutiveFailures int
+	AvgLatency          time.Duration
+	Disabled            bool
+	DisabledAt          time.Time
+}
+
+// WebSub is the push subscription state of a source. Hub and Topic come
+// from the feed; Secret signs the pushed content; RequestedAt is when we
+// last asked the hub to subscribe and LeaseExpiresAt when the verified
+// subscription runs out.
+type WebSub struct {
+	Hub            string
+	Topic          string
+	Secret         string
+	RequestedAt    time.Time
+	LeaseExpiresAt time.Time
+}
+
+// Active reports whether the hub is currently pushing the source.
+func (w WebSub) Active(now time.Time) bool {
+	return w.Hub != "" && w.LeaseExpiresAt.After(now)
+}
+
+type SourceOptions struct {
+	Scrape *ScrapeOptions `json:"scrape,omitempty"`
+	JSON   *JSONOptions   `json:"json,omitempty"`
+	// FullText makes the fetcher download each new item's page and store
+	// the extracted article instead of the feed's teaser.
+	FullText bool `json:"fullText,omitempty"`
+}
+
+// ScrapeOptions describes how to extract items from an HTML page. Item
+// selects the item containers; the other selectors are applied inside each
+// container. The link is read from the href attribute and the date from a
+// datetime attribute when present, otherwise from the element text.
+type ScrapeOptions struct {
+	Item       string `json:"item"`
+	Title      string `json:"title"`
+	Link       string `json:"link"`
+	Date       string `json:"date,omitempty"`
+	DateLayout string `json:"dateLayout,omitempty"`
+	Summary    string `json:"summary,omitempty"`
+}
+
+// JSONOptions maps a JSON API response to items. Items is a path such as
+// "$.data.posts" to the item array; the field paths are relative to each
+// item and may use indexes and wildcards ("tags[*].name"). Headers are sent
+// with every request, e.g. for authorization.
+type JSONOptions struct {
+	Items      string            `json:"items"`
+	Title      string            `json:"title"`
+	Link       string            `json:"link"`
+	GUID       string            `json:"guid,omitempty"`
+	Date       string            `json:"date,omitempty"`
+	DateLayout string            `json:"dateLayout,omitempty"`
+	Summary    string            `json:"summary,omitempty"`
+	Categories string            `json:"categories,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+type FilterRule struct {
+	Name          string `yaml:"name" json:"name"`
+	Expr          string `yaml:"expr" json:"expr"`
+	CaseSensitive bool   `yaml:"caseSensitive" json:"caseSensitive"`
+	WholeWord     bool   `yaml:"wholeWord" json:"wholeWord"`
+}
+
+type FilterRules struct {
+	Include []FilterRule `yaml:"include" json:"include"`
+	Exclude []FilterRule `yaml:"exclude" json:"exclude"`
 }
 
 type Article struct {
-	ID          int64
-	SourceID    int64
-	Title       string
-	Categories  []string
-	Link        string
-	Summary     string
+	ID         int64
+	SourceID   int64
+	GUID       string
+	Title      string
+	Categories []string
+	Link       string
+	// CanonicalLink is Link normalised for deduplication.
+	CanonicalLink string
+	Summary       string
+	Content       string
+	Author        string
+	Enclosures    []Enclosure
+	ImageURL      string
+	// PublishedAt is the item's own date when plausible, FirstSeenAt
+	// otherwise; it is the date articles are ordered by.
 	PublishedAt time.Time
+	// FirstSeenAt is when the fetcher first stored the article.
+	FirstSeenAt time.Time
 	PostedAt    time.Time
 	CreatedAt   time.Time
 }
 
+// BatchResult describes the outcome of storing a batch of articles.
+// TitleDuplicates are the items dropped as re-publications of a recent
+// article with a similar title; Duplicates are the ones already stored.
+type BatchResult struct {
+	New             int
+	Duplicates      int
+	TitleDuplicates int
+	Failed          int
+	Errors          []error
+}
+
+// FetchRun records one fetch of one source. HTTPStatus is zero when no
+// response was received.
+type FetchRun struct {
+	ID         int64
+	SourceID   int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	HTTPStatus int
+	Items      int
+	New        int
+	Duplicates int
+	// TitleDuplicates counts the items dropped for a similar title.
+	TitleDuplicates int
+	Filtered        int
+	Error           string
+}
+
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySkipped = "skipped"
+)
+
+// Delivery tracks one article sent to one user. MessageID is the Telegram
+// message it was sent as.
+type Delivery struct {
+	UserID    int64
+	ArticleID int64
+	Status    string
+	MessageID int
+	Attempts  int
+	Error     string
+	UpdatedAt time.Time
+}
+
+// Subscription is a user's subscription to a source. Category is the
+// user's folder for it, nested folders joined by "/"; Weight is the user's
+// own adjustment of the source priority when articles are ranked.
+type Subscription struct {
+	Source   Source
+	Category string
+	Weight   int
+}
+
 type TgUser struct {
 	TgId     int64
 	Username string
+	Delivery DeliverySettings
+}
+
+const (
+	DeliveryModeInstant = "instant"
+	DeliveryModeDigest  = "digest"
+)
+
+// DeliverySettings is how a user wants articles: one by one as they arrive,
+// or as a digest at Minute minutes past local midnight, every day or only
+// on Weekday (-1 means daily).
+type DeliverySettings struct {
+	Mode         string
+	Minute       int
+	Weekday      int
+	Timezone     string
+	LastDigestAt time.Time
+}
+
+func (s DeliverySettings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NextDigest returns the first digest time after t.
+func (s DeliverySettings) NextDigest(t time.Time) time.Time {
+	local := t.In(s.Location())
+	for i := 0; i <= 7; i++ {
+		day := local.AddDate(0, 0, i)
+		candidate := time.Date(day.Year(), day.Month(), day.Day(), s.Minute/60, s.Minute%60, 0, 0, day.Location())
+		if candidate.After(t) && (s.Weekday < 0 || candidate.Weekday() == time.Weekday(s.Weekday)) {
+			return candidate
+		}
+	}
+	return t.AddDate(0, 0, 7)
 }
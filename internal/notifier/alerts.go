@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type SourceSubscribers interface {
+	GetUserIDsBySourceID(ctx context.Context, sourceID int64) ([]int64, error)
+}
+
+// SourceAlerter tells subscribers and admins that a source was disabled.
+type SourceAlerter struct {
+	sender   Sender
+	subsRepo SourceSubscribers
+	admins   []int64
+}
+
+func NewSourceAlerter(sender Sender, subsRepo SourceSubscribers, admins []int64) *SourceAlerter {
+	return &SourceAlerter{sender: sender, subsRepo: subsRepo, admins: admins}
+}
+
+func (a *SourceAlerter) SourceDisabled(ctx context.Context, source models.Source, failures int, reason error) error {
+	subscribers, err := a.subsRepo.GetUserIDsBySourceID(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+
+	var sendErrs []error
+	userText := fmt.Sprintf("Источник %q временно отключён: он перестал отвечать. Новые статьи из него не будут приходить, пока администратор не включит его снова.", source.Name)
+	for _, userID := range subscribers {
+		if _, err := a.sender.Send(ctx, tgbotapi.NewMessage(userID, userText), outbox.Bulk); err != nil {
+			sendErrs = append(sendErrs, err)
+		}
+	}
+
+	adminText := fmt.Sprintf("Источник %q (ID %d) отключён после %d ошибок подряд.\nПоследняя ошибка: %v\nВключить снова: /enablesource %d",
+		source.Name, source.ID, failures, reason, source.ID)
+	for _, adminID := range a.admins {
+		if _, err := a.sender.Send(ctx, tgbotapi.NewMessage(adminID, adminText), outbox.Bulk); err != nil {
+			sendErrs = append(sendErrs, err)
+		}
+	}
+
+	return errors.Join(sendErrs...)
+}
@@ -0,0 +1,197 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxDigestArticles = 50
+	// maxMessageLength keeps digest parts under Telegram's 4096 character
+	// limit.
+	maxMessageLength = 4000
+)
+
+// digestPart is one message of a digest and the articles it lists.
+type digestPart struct {
+	text     string
+	articles []models.Article
+}
+
+// digestDue reports whether the scheduled digest time has passed since the
+// last digest.
+func digestDue(settings models.DeliverySettings, now time.Time) bool {
+	if settings.LastDigestAt.IsZero() {
+		return true
+	}
+	return !settings.NextDigest(settings.LastDigestAt).After(now)
+}
+
+// sendDigest sends the articles the subscriber has not received yet as one
+// digest, split into several messages when it is too long. Each part's
+// articles are reserved right before the part is sent, so nothing is left
+// pending when the digest stops half-way. The digest clock moves on even
+// when there is nothing to send.
+func (n *Notifier) sendDigest(ctx context.Context, subscriber models.TgUser) error {
+	now := time.Now()
+	articles, err := n.articleRepo.GetUndelivered(ctx, subscriber.TgId, maxDigestArticles, n.ranking.PriorityStep)
+	if err != nil {
+		return err
+	}
+
+	if len(articles) > 0 {
+		parts, err := n.formatDigest(ctx, subscriber, articles, now)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			reserved, err := n.reserveAll(ctx, subscriber, part.articles)
+			if err != nil {
+				return err
+			}
+			if len(reserved) == 0 {
+				continue
+			}
+			part.articles = reserved
+			if err := n.sendDigestPart(ctx, subscriber, part); err != nil {
+				return err
+			}
+		}
+	}
+	return n.userRepo.MarkDigestSent(ctx, subscriber.TgId, now)
+}
+
+// reserveAll reserves the articles that are still to be delivered. If a
+// reservation fails, the ones already made are marked failed so they are
+// retried.
+func (n *Notifier) reserveAll(ctx context.Context, subscriber models.TgUser, articles []models.Article) ([]models.Article, error) {
+	reserved := make([]models.Article, 0, len(articles))
+	for _, article := range articles {
+		ok, err := n.deliveries.Reserve(ctx, subscriber.TgId, article.ID)
+		if err != nil {
+			n.release(ctx, subscriber, reserved, err)
+			return nil, err
+		}
+		if ok {
+			reserved = append(reserved, article)
+		}
+	}
+	return reserved, nil
+}
+
+// release marks reserved articles failed, so they come back next time.
+func (n *Notifier) release(ctx context.Context, subscriber models.TgUser, articles []models.Article, reason error) {
+	for _, article := range articles {
+		if err := n.deliveries.MarkFailed(ctx, subscriber.TgId, article.ID, reason.Error()); err != nil {
+			log.Printf("[ERROR] failed to record failed delivery of article %d to user %d: %v", article.ID, subscriber.TgId, err)
+		}
+	}
+}
+
+func (n *Notifier) sendDigestPart(ctx context.Context, subscriber models.TgUser, part digestPart) error {
+	msg := tgbotapi.NewMessage(subscriber.TgId, part.text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	sent, sendErr := n.sender.Send(ctx, msg, outbox.Bulk)
+	if sendErr != nil {
+		log.Printf("[ERROR] failed to send digest to user %d: %v", subscriber.TgId, sendErr)
+	}
+
+	// Every article is recorded even if one of the updates fails, so none
+	// is left pending.
+	var recordErr error
+	for _, article := range part.articles {
+		var err error
+		if sendErr != nil {
+			err = n.deliveries.MarkFailed(ctx, subscriber.TgId, article.ID, sendErr.Error())
+		} else {
+			err = n.deliveries.MarkSent(ctx, subscriber.TgId, article.ID, sent.MessageID)
+		}
+		if err != nil && recordErr == nil {
+			recordErr = err
+		}
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	if sendErr != nil {
+		return n.dropChat(ctx, subscriber, sendErr)
+	}
+	return nil
+}
+
+// PreviewDigest renders the digest the user would get now, without
+// marking anything as delivered.
+func (n *Notifier) PreviewDigest(ctx context.Context, user models.TgUser) ([]string, error) {
+	articles, err := n.articleRepo.GetUndelivered(ctx, user.TgId, maxDigestArticles, n.ranking.PriorityStep)
+	if err != nil {
+		return nil, err
+	}
+	if len(articles) == 0 {
+		return nil, nil
+	}
+	parts, err := n.formatDigest(ctx, user, articles, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		texts = append(texts, part.text)
+	}
+	return texts, nil
+}
+
+// formatDigest groups the articles by source, sources in name order, and
+// splits the result into messages that fit Telegram's limit.
+func (n *Notifier) formatDigest(ctx context.Context, user models.TgUser, articles []models.Article, now time.Time) ([]digestPart, error) {
+	sources, err := n.subsRepo.GetSourcesByUserID(ctx, user.TgId)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(sources))
+	for _, source := range sources {
+		names[source.ID] = source.Name
+	}
+
+	bySource := make(map[int64][]models.Article)
+	var sourceIDs []int64
+	for _, article := range articles {
+		if _, ok := bySource[article.SourceID]; !ok {
+			sourceIDs = append(sourceIDs, article.SourceID)
+		}
+		bySource[article.SourceID] = append(bySource[article.SourceID], article)
+	}
+	sort.SliceStable(sourceIDs, func(i, j int) bool {
+		return strings.ToLower(names[sourceIDs[i]]) < strings.ToLower(names[sourceIDs[j]])
+	})
+
+	header := fmt.Sprintf("<b>Дайджест за %s</b> — статей: %d\n", now.In(user.Delivery.Location()).Format("02.01.2006"), len(articles))
+	var parts []digestPart
+	current := digestPart{text: header}
+	for _, sourceID := range sourceIDs {
+		name := names[sourceID]
+		if name == "" {
+			name = fmt.Sprintf("Источник %d", sourceID)
+		}
+		heading := fmt.Sprintf("\n<b>%s</b>\n", html.EscapeString(name))
+		current.text += heading
+		for _, article := range bySource[sourceID] {
+			line := fmt.Sprintf("• <a href=\"%s\">%s</a>\n", html.EscapeString(article.Link), html.EscapeString(article.Title))
+			if len(current.text)+len(line) > maxMessageLength && len(current.articles) > 0 {
+				parts = append(parts, current)
+				current = digestPart{text: heading}
+			}
+			current.text += line
+			current.articles = append(current.articles, article)
+		}
+	}
+	return append(parts, current), nil
+}
@@ -2,39 +2,60 @@ package notifier
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"sync"
 	"time"
 )
 
+// Sender queues outgoing messages within Telegram's rate limits; see
+// outbox.Queue.
+type Sender interface {
+	Send(ctx context.Context, msg tgbotapi.Chattable, priority outbox.Priority) (tgbotapi.Message, error)
+}
+
 type UserRepo interface {
 	GetAllUsers(ctx context.Context) ([]models.TgUser, error)
 	AddTgUser(ctx context.Context, tgUser models.TgUser) error
+	MarkDigestSent(ctx context.Context, userID int64, sentAt time.Time) error
+	Deactivate(ctx context.Context, userID int64, reason string) error
+	MigrateChat(ctx context.Context, oldID, newID int64) error
 }
 
+// errChatGone stops the deliveries to a chat that can no longer be sent to.
+var errChatGone = errors.New("chat can no longer be sent to")
+
 type ArticleRepo interface {
-	MarkAsPosted(ctx context.Context, article models.Article) error
-	GetAllNotPostedByUserSources(ctx context.Context, userID int64) ([]models.Article, error)
+	GetUndelivered(ctx context.Context, userID int64, limit int, priorityStep time.Duration) ([]models.Article, error)
 	GetAll(ctx context.Context) ([]models.Article, error)
 }
 
+type DeliveryRepo interface {
+	Reserve(ctx context.Context, userID, articleID int64) (bool, error)
+	MarkSent(ctx context.Context, userID, articleID int64, messageID int) error
+	MarkFailed(ctx context.Context, userID, articleID int64, reason string) error
+}
+
 type SubsRepo interface {
 	GetSourcesByUserID(ctx context.Context, userID int64) ([]models.Source, error)
 }
 
 type Notifier struct {
-	bot          *tgbotapi.BotAPI
+	sender       Sender
 	articleRepo  ArticleRepo
+	deliveries   DeliveryRepo
 	userRepo     UserRepo
 	subsRepo     SubsRepo
 	sendInterval time.Duration
+	ranking      Ranking
 }
 
-func NewNotifier(bot *tgbotapi.BotAPI, userRepo UserRepo, articles ArticleRepo, subs SubsRepo, sendInterval time.Duration) *Notifier {
-	return &Notifier{bot: bot, userRepo: userRepo, articleRepo: articles, subsRepo: subs, sendInterval: sendInterval}
+func NewNotifier(sender Sender, userRepo UserRepo, articles ArticleRepo, deliveries DeliveryRepo, subs SubsRepo, sendInterval time.Duration, ranking Ranking) *Notifier {
+	return &Notifier{sender: sender, userRepo: userRepo, articleRepo: articles, deliveries: deliveries, subsRepo: subs, sendInterval: sendInterval, ranking: ranking.withDefaults()}
 }
 
 func (n *Notifier) Start(ctx context.Context) error {
@@ -67,32 +88,16 @@ func (n *Notifier) Notify(ctx context.Context) error {
 
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(subscribers))
-	mu := &sync.Mutex{}
-	articlesToSend := make(map[int64]models.Article)
 
 	for _, subscriber := range subscribers {
 		wg.Add(1)
 
-		go func(userID int64) {
+		go func(subscriber models.TgUser) {
 			defer wg.Done()
-			// TODO Think with that 1 limit to send in
-			articles, err := n.articleRepo.GetAllNotPostedByUserSources(ctx, userID)
-			fmt.Println(articles)
-			if err != nil {
+			if err := n.notifyUser(ctx, subscriber); err != nil && !errors.Is(err, errChatGone) {
 				errChan <- err
-				return
-			}
-			if len(articles) == 0 {
-				return
 			}
-			articleToSend := articles[0]
-			mu.Lock()
-			articlesToSend[articleToSend.ID] = articleToSend
-			mu.Unlock()
-			if err = n.send(articleToSend, subscriber); err != nil {
-				errChan <- err
-			}
-		}(subscriber.TgId)
+		}(subscriber)
 	}
 
 	wg.Wait()
@@ -105,10 +110,6 @@ func (n *Notifier) Notify(ctx context.Context) error {
 			sendErrs = append(sendErrs, err)
 		}
 	}
-	if err := n.markArticleAsPosted(ctx, articlesToSend); err != nil {
-		sendErrs = append(sendErrs, err)
-	}
-
 	if len(sendErrs) > 0 {
 		return fmt.Errorf("encountered errors during notification: %v", sendErrs)
 	}
@@ -116,38 +117,98 @@ func (n *Notifier) Notify(ctx context.Context) error {
 	return nil
 }
 
-func (n *Notifier) markArticleAsPosted(ctx context.Context, articlesToSend map[int64]models.Article) error {
-	for _, article := range articlesToSend {
-		if err := n.articleRepo.MarkAsPosted(ctx, article); err != nil {
-			log.Printf("[ERROR] failed to mark article as posted: %s", err.Error())
+func (n *Notifier) notifyUser(ctx context.Context, subscriber models.TgUser) error {
+	if subscriber.Delivery.Mode == models.DeliveryModeDigest {
+		if !digestDue(subscriber.Delivery, time.Now()) {
+			return nil
+		}
+		return n.sendDigest(ctx, subscriber)
+	}
+
+	articles, err := n.articleRepo.GetUndelivered(ctx, subscriber.TgId, n.ranking.PerTick, n.ranking.PriorityStep)
+	if err != nil {
+		return err
+	}
+	for _, article := range articles {
+		if err := n.deliver(ctx, article, subscriber); err != nil {
 			return err
 		}
-		log.Println("article marked", article.ID)
 	}
 	return nil
 }
 
-func (n *Notifier) send(article models.Article, subscriber models.TgUser) error {
-	msg := n.formatMessage(article)
-	if err := n.sendMessageToUser(subscriber.TgId, msg); err != nil {
+// dropChat handles a send error that means the chat is gone: the user is
+// deactivated, or a group that became a supergroup moves to its new chat
+// ID. It returns errChatGone in that case and nil for any other error.
+func (n *Notifier) dropChat(ctx context.Context, subscriber models.TgUser, sendErr error) error {
+	problem, migrateTo := outbox.ClassifyError(sendErr)
+	switch problem {
+	case outbox.ChatOK:
+		return nil
+	case outbox.ChatMigrated:
+		log.Printf("[INFO] chat %d migrated to %d", subscriber.TgId, migrateTo)
+		if err := n.userRepo.MigrateChat(ctx, subscriber.TgId, migrateTo); err != nil {
+			return err
+		}
+	default:
+		log.Printf("[INFO] deactivating user %d: %s", subscriber.TgId, problem)
+		if err := n.userRepo.Deactivate(ctx, subscriber.TgId, problem.String()); err != nil {
+			return err
+		}
+	}
+	return errChatGone
+}
+
+// deliver sends an article to a subscriber once: the delivery is reserved
+// first and its outcome recorded afterwards. A failed send is recorded for
+// a later retry rather than returned; only storage errors and errChatGone
+// are.
+func (n *Notifier) deliver(ctx context.Context, article models.Article, subscriber models.TgUser) error {
+	reserved, err := n.deliveries.Reserve(ctx, subscriber.TgId, article.ID)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return nil
+	}
+
+	sent, sendErr := n.send(ctx, article, subscriber)
+	if sendErr != nil {
+		if err := n.deliveries.MarkFailed(ctx, subscriber.TgId, article.ID, sendErr.Error()); err != nil {
+			log.Printf("[ERROR] failed to record failed delivery of article %d to user %d: %v", article.ID, subscriber.TgId, err)
+			return err
+		}
+		return n.dropChat(ctx, subscriber, sendErr)
+	}
+	if err := n.deliveries.MarkSent(ctx, subscriber.TgId, article.ID, sent.MessageID); err != nil {
+		log.Printf("[ERROR] failed to record delivery of article %d to user %d: %v", article.ID, subscriber.TgId, err)
 		return err
 	}
+	return nil
+}
+
+func (n *Notifier) send(ctx context.Context, article models.Article, subscriber models.TgUser) (tgbotapi.Message, error) {
+	msg := n.formatMessage(article)
+	sent, err := n.sendMessageToUser(ctx, subscriber.TgId, msg)
+	if err != nil {
+		return sent, err
+	}
 
 	log.Printf("Sending message: %v", msg)
 
-	return nil
+	return sent, nil
 }
 
-func (n *Notifier) sendMessageToUser(userId int64, msg string) error {
+func (n *Notifier) sendMessageToUser(ctx context.Context, userId int64, msg string) (tgbotapi.Message, error) {
 	telegramMsg := tgbotapi.NewMessage(userId, msg)
 	telegramMsg.ParseMode = "Markdown"
 
-	_, err := n.bot.Send(telegramMsg)
+	sent, err := n.sender.Send(ctx, telegramMsg, outbox.Bulk)
 	if err != nil {
 		log.Printf("[ERROR] failed to send message to user %d: %s", userId, err.Error())
-		return err
+		return sent, err
 	}
-	return nil
+	return sent, nil
 }
 
 func (n *Notifier) formatMessage(article models.Article) string {
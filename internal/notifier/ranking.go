@@ -0,0 +1,29 @@
+package notifier
+
+import (
+	"time"
+)
+
+const (
+	defaultPerTick      = 1
+	defaultPriorityStep = 12 * time.Hour
+)
+
+// Ranking decides which undelivered articles go out first. PerTick is how
+// many articles a user in instant mode gets per send interval.
+// PriorityStep is how much freshness one point of source priority, or of
+// the user's weight for the source, is worth.
+type Ranking struct {
+	PerTick      int
+	PriorityStep time.Duration
+}
+
+func (r Ranking) withDefaults() Ranking {
+	if r.PerTick <= 0 {
+		r.PerTick = defaultPerTick
+	}
+	if r.PriorityStep <= 0 {
+		r.PriorityStep = defaultPriorityStep
+	}
+	return r
+}
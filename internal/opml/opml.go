@@ -0,0 +1,147 @@
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Feed is a subscription as OPML sees it. Category is the folder path,
+// with nested folders joined by "/".
+type Feed struct {
+	Title    string
+	URL      string
+	SiteURL  string
+	Category string
+}
+
+type document struct {
+	XMLName xml.Name  `xml:"opml"`
+	Version string    `xml:"version,attr"`
+	Head    head      `xml:"head"`
+	Body    []outline `xml:"body>outline"`
+}
+
+type head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
+}
+
+// Parse reads the feeds of an OPML document. Outlines without a feed URL
+// are folders; the feeds inside them get the folder path as category.
+func Parse(r io.Reader) ([]Feed, error) {
+	var doc document
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid OPML: %w", err)
+	}
+
+	var feeds []Feed
+	var walk func(outlines []outline, category string)
+	walk = func(outlines []outline, category string) {
+		for _, o := range outlines {
+			name := strings.TrimSpace(o.Title)
+			if name == "" {
+				name = strings.TrimSpace(o.Text)
+			}
+			if url := strings.TrimSpace(o.XMLURL); url != "" {
+				if name == "" {
+					name = url
+				}
+				feeds = append(feeds, Feed{Title: name, URL: url, SiteURL: strings.TrimSpace(o.HTMLURL), Category: category})
+				continue
+			}
+			folder := category
+			if name != "" {
+				folder = strings.TrimPrefix(category+"/"+name, "/")
+			}
+			walk(o.Outlines, folder)
+		}
+	}
+	walk(doc.Body, "")
+	return feeds, nil
+}
+
+// Write renders the feeds as an OPML 2.0 document with one folder per
+// category.
+func Write(w io.Writer, title string, feeds []Feed) error {
+	doc := document{
+		Version: "2.0",
+		Head:    head{Title: title, DateCreated: time.Now().UTC().Format(time.RFC1123Z)},
+	}
+
+	sorted := append([]Feed(nil), feeds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Category != sorted[j].Category {
+			return sorted[i].Category < sorted[j].Category
+		}
+		return strings.ToLower(sorted[i].Title) < strings.ToLower(sorted[j].Title)
+	})
+
+	root := &folder{}
+	for _, feed := range sorted {
+		f := root
+		if feed.Category != "" {
+			for _, name := range strings.Split(feed.Category, "/") {
+				f = f.child(name)
+			}
+		}
+		f.feeds = append(f.feeds, outline{
+			Text:    feed.Title,
+			Title:   feed.Title,
+			Type:    "rss",
+			XMLURL:  feed.URL,
+			HTMLURL: feed.SiteURL,
+		})
+	}
+	doc.Body = root.outlines()
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type folder struct {
+	name     string
+	feeds    []outline
+	children []*folder
+}
+
+func (f *folder) child(name string) *folder {
+	for _, c := range f.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &folder{name: name}
+	f.children = append(f.children, c)
+	return c
+}
+
+func (f *folder) outlines() []outline {
+	outlines := append([]outline(nil), f.feeds...)
+	for _, c := range f.children {
+		outlines = append(outlines, outline{Text: c.name, Title: c.name, Outlines: c.outlines()})
+	}
+	return outlines
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strings"
+)
+
+// ChatProblem is why a chat cannot be sent to any more.
+type ChatProblem int
+
+const (
+	// ChatOK means the error says nothing about the chat itself.
+	ChatOK ChatProblem = iota
+	// ChatBlocked: the user blocked the bot or the bot left the group.
+	ChatBlocked
+	ChatNotFound
+	UserDeactivated
+	// ChatMigrated: the group became a supergroup with a new chat ID.
+	ChatMigrated
+)
+
+func (p ChatProblem) String() string {
+	switch p {
+	case ChatBlocked:
+		return "blocked"
+	case ChatNotFound:
+		return "chat not found"
+	case UserDeactivated:
+		return "user deactivated"
+	case ChatMigrated:
+		return "migrated"
+	default:
+		return "ok"
+	}
+}
+
+// ClassifyError tells the send errors after which the chat is gone from
+// the ones worth retrying. For a migrated group it also returns the new
+// chat ID. The description is checked as well as the code, because
+// tgbotapi leaves the code unset for errors of file uploads.
+func ClassifyError(err error) (ChatProblem, int64) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return ChatOK, 0
+	}
+	description := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.MigrateToChatID != 0:
+		return ChatMigrated, apiErr.MigrateToChatID
+	case strings.Contains(description, "user is deactivated"):
+		return UserDeactivated, 0
+	case strings.Contains(description, "chat not found"), strings.Contains(description, "chat was deleted"):
+		return ChatNotFound, 0
+	case apiErr.Code == http.StatusForbidden, strings.HasPrefix(description, "forbidden:"):
+		// Blocked by the user, kicked from the group, or never started.
+		return ChatBlocked, 0
+	}
+	return ChatOK, 0
+}
@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		want        ChatProblem
+		wantMigrate int64
+	}{
+		{"blocked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, ChatBlocked, 0},
+		{"kicked from group", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the group chat"}, ChatBlocked, 0},
+		{"kicked from supergroup", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the supergroup chat"}, ChatBlocked, 0},
+		{"never started", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot can't initiate conversation with a user"}, ChatBlocked, 0},
+		{"deactivated", &tgbotapi.Error{Code: 403, Message: "Forbidden: user is deactivated"}, UserDeactivated, 0},
+		{"chat not found", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, ChatNotFound, 0},
+		{"group deleted", &tgbotapi.Error{Code: 403, Message: "Forbidden: the group chat was deleted"}, ChatNotFound, 0},
+		{
+			"migrated",
+			&tgbotapi.Error{
+				Code:               400,
+				Message:            "Bad Request: group chat was upgraded to a supergroup chat",
+				ResponseParameters: tgbotapi.ResponseParameters{MigrateToChatID: -1001234567890},
+			},
+			ChatMigrated, -1001234567890,
+		},
+		// File uploads report errors without a code.
+		{"upload blocked", &tgbotapi.Error{Message: "Forbidden: bot was blocked by the user"}, ChatBlocked, 0},
+		{"upload deactivated", &tgbotapi.Error{Message: "Forbidden: user is deactivated"}, UserDeactivated, 0},
+		{"upload chat not found", &tgbotapi.Error{Message: "Bad Request: chat not found"}, ChatNotFound, 0},
+		{
+			"upload migrated",
+			&tgbotapi.Error{
+				Message:            "Bad Request: group chat was upgraded to a supergroup chat",
+				ResponseParameters: tgbotapi.ResponseParameters{MigrateToChatID: -10042},
+			},
+			ChatMigrated, -10042,
+		},
+		{"wrapped", fmt.Errorf("send: %w", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}), ChatBlocked, 0},
+		{"rate limited", &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5}}, ChatOK, 0},
+		{"bad markup", &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities: unsupported start tag"}, ChatOK, 0},
+		{"network", errors.New("dial tcp: connection refused"), ChatOK, 0},
+		{"nil", nil, ChatOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, migrateTo := ClassifyError(tt.err)
+			if got != tt.want || migrateTo != tt.wantMigrate {
+				t.Errorf("ClassifyError() = %v, %d, want %v, %d", got, migrateTo, tt.want, tt.wantMigrate)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Telegram allows about 30 messages a second overall and one a second
+	// per chat.
+	defaultPerSecond  = 30
+	defaultPerChat    = time.Second
+	defaultMaxRetries = 3
+	// pruneAfter is how many chats are remembered before the ones that
+	// can be sent to again are forgotten.
+	pruneAfter = 10000
+)
+
+// Priority orders the queued messages: all interactive messages that may be
+// sent go out before any bulk message.
+type Priority int
+
+const (
+	// Interactive is for replies to the user's own commands.
+	Interactive Priority = iota
+	// Bulk is for notifications.
+	Bulk
+)
+
+type Config struct {
+	// PerSecond is the number of messages sent a second overall.
+	PerSecond int `yaml:"perSecond"`
+	// PerChat is the minimal gap between two messages to one chat.
+	PerChat time.Duration `yaml:"perChat"`
+	// MaxRetries is how often a message is sent again after Telegram
+	// answers 429 Too Many Requests.
+	MaxRetries int `yaml:"maxRetries"`
+}
+
+// Queue sends the bot's messages within Telegram's rate limits. Every
+// message goes through it, so the limits hold across the bot and the
+// notifier.
+type Queue struct {
+	api *tgbotapi.BotAPI
+	cfg Config
+
+	mu      sync.Mutex
+	pending [Bulk + 1][]*job
+	// lastSent is when each chat was last sent to, nextSend when the next
+	// message may go out at all and pausedUntil when Telegram lets us send
+	// again after a 429.
+	lastSent    map[int64]time.Time
+	nextSend    time.Time
+	pausedUntil time.Time
+	wake        chan struct{}
+}
+
+type job struct {
+	ctx      context.Context
+	chatID   int64
+	msg      tgbotapi.Chattable
+	priority Priority
+	retries  int
+	done     chan result
+}
+
+type result struct {
+	msg tgbotapi.Message
+	err error
+}
+
+func New(api *tgbotapi.BotAPI, cfg Config) *Queue {
+	if cfg.PerSecond <= 0 {
+		cfg.PerSecond = defaultPerSecond
+	}
+	if cfg.PerChat <= 0 {
+		cfg.PerChat = defaultPerChat
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	return &Queue{
+		api:      api,
+		cfg:      cfg,
+		lastSent: make(map[int64]time.Time),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Send queues a message and waits until it has been sent. A message whose
+// ctx is done before its turn comes is dropped.
+func (q *Queue) Send(ctx context.Context, msg tgbotapi.Chattable, priority Priority) (tgbotapi.Message, error) {
+	if priority < Interactive || priority > Bulk {
+		priority = Bulk
+	}
+	j := &job{
+		ctx:      ctx,
+		chatID:   chatID(msg),
+		msg:      msg,
+		priority: priority,
+		done:     make(chan result, 1),
+	}
+
+	q.mu.Lock()
+	q.pending[priority] = append(q.pending[priority], j)
+	q.mu.Unlock()
+	q.notify()
+
+	select {
+	case r := <-j.done:
+		return r.msg, r.err
+	case <-ctx.Done():
+		return tgbotapi.Message{}, ctx.Err()
+	}
+}
+
+// Start sends the queued messages until ctx is done.
+func (q *Queue) Start(ctx context.Context) error {
+	for {
+		j, wait := q.next(time.Now())
+		if j != nil {
+			go q.send(j)
+			continue
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-q.wake:
+		case <-timer:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the first message that may be sent now, in priority order.
+// Otherwise it returns how long to wait for one, zero when nothing is
+// pending.
+func (q *Queue) next(now time.Time) (*job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.hasPending() {
+		return nil, 0
+	}
+	if now.Before(q.pausedUntil) {
+		return nil, q.pausedUntil.Sub(now)
+	}
+	if now.Before(q.nextSend) {
+		return nil, q.nextSend.Sub(now)
+	}
+
+	var wait time.Duration
+	for p := range q.pending {
+		jobs := q.pending[p]
+		for i := 0; i < len(jobs); i++ {
+			j := jobs[i]
+			if err := j.ctx.Err(); err != nil {
+				jobs = append(jobs[:i], jobs[i+1:]...)
+				i--
+				j.done <- result{err: err}
+				continue
+			}
+			if ready := q.lastSent[j.chatID].Add(q.cfg.PerChat); j.chatID != 0 && now.Before(ready) {
+				if wait == 0 || ready.Sub(now) < wait {
+					wait = ready.Sub(now)
+				}
+				continue
+			}
+
+			q.pending[p] = append(jobs[:i], jobs[i+1:]...)
+			q.nextSend = now.Add(time.Second / time.Duration(q.cfg.PerSecond))
+			if j.chatID != 0 {
+				q.lastSent[j.chatID] = now
+				q.prune(now)
+			}
+			return j, 0
+		}
+		q.pending[p] = jobs
+	}
+	return nil, wait
+}
+
+func (q *Queue) hasPending() bool {
+	for _, jobs := range q.pending {
+		if len(jobs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) prune(now time.Time) {
+	if len(q.lastSent) < pruneAfter {
+		return
+	}
+	for chatID, sentAt := range q.lastSent {
+		if now.Sub(sentAt) >= q.cfg.PerChat {
+			delete(q.lastSent, chatID)
+		}
+	}
+}
+
+// send sends a message. On 429 the whole queue pauses for as long as
+// Telegram asks and the message goes back to the head of its queue.
+func (q *Queue) send(j *job) {
+	msg, err := q.api.Send(j.msg)
+
+	// Uploads report errors without a code, but still with retry_after.
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusTooManyRequests || apiErr.RetryAfter > 0) && j.retries < q.cfg.MaxRetries {
+		retryAfter := time.Duration(apiErr.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		log.Printf("[INFO] Telegram rate limit hit sending to chat %d, pausing for %s", j.chatID, retryAfter)
+
+		q.mu.Lock()
+		if until := time.Now().Add(retryAfter); until.After(q.pausedUntil) {
+			q.pausedUntil = until
+		}
+		j.retries++
+		q.pending[j.priority] = append([]*job{j}, q.pending[j.priority]...)
+		q.mu.Unlock()
+		q.notify()
+		return
+	}
+	j.done <- result{msg: msg, err: err}
+}
+
+// chatID is the chat a message goes to, zero when it is not bound to one.
+func chatID(msg tgbotapi.Chattable) int64 {
+	switch m := msg.(type) {
+	case tgbotapi.MessageConfig:
+		return m.ChatID
+	case tgbotapi.DocumentConfig:
+		return m.ChatID
+	case tgbotapi.PhotoConfig:
+		return m.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return m.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return m.ChatID
+	}
+	return 0
+}
@@ -2,9 +2,11 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"log"
+	"strings"
 	"time"
 )
 
@@ -16,18 +18,48 @@ func NewArticleRepository(db *pgxpool.Pool) *ArticleRepository {
 	return &ArticleRepository{db: db}
 }
 
-func (r *ArticleRepository) Add(ctx context.Context, article models.Article) error {
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO articles (source_id, title, link, published_at)
-		 SELECT $1, $2, $3, $4
-		 WHERE NOT EXISTS (
-			 SELECT 1 FROM articles WHERE link = $3
-		 );`,
+// insertArticleQuery relies on the unique indexes on (source_id, guid) and
+// canonical_link; duplicates are skipped and report zero affected rows.
+const insertArticleQuery = `
+	INSERT INTO articles (source_id, title, link, published_at, guid, summary, content, author, categories, enclosures, canonical_link, image_url, first_seen_at)
+	VALUES ($1, $2, $3, $4::timestamp, $5, $6, $7, $8, $9, $10, $11, $12, $13::timestamp)
+	ON CONFLICT DO NOTHING;`
+
+// articleArgs binds an article to insertArticleQuery. pgx sends nil slices
+// as NULL, which the NOT NULL categories and enclosures columns refuse.
+func articleArgs(article models.Article) []any {
+	categories := article.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	enclosures := article.Enclosures
+	if enclosures == nil {
+		enclosures = []models.Enclosure{}
+	}
+	return []any{
 		article.SourceID,
-		article.Title,
-		article.Link,
-		article.PublishedAt,
-	)
+		cleanText(article.Title),
+		cleanText(article.Link),
+		article.PublishedAt.UTC(),
+		cleanText(article.GUID),
+		cleanText(article.Summary),
+		cleanText(article.Content),
+		cleanText(article.Author),
+		categories,
+		enclosures,
+		cleanText(article.CanonicalLink),
+		cleanText(article.ImageURL),
+		article.FirstSeenAt.UTC(),
+	}
+}
+
+// cleanText removes what Postgres refuses to store in text columns.
+func cleanText(s string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(s, ""), "\x00", "")
+}
+
+func (r *ArticleRepository) Add(ctx context.Context, article models.Article) error {
+	_, err := r.db.Exec(ctx, insertArticleQuery, articleArgs(article)...)
 	if err != nil {
 		return err
 	}
@@ -35,6 +67,116 @@ func (r *ArticleRepository) Add(ctx context.Context, article models.Article) err
 	return nil
 }
 
+// AddBatch inserts the articles in a single round trip and reports how many
+// were new and how many were already stored. A batch runs as one implicit
+// transaction, so when any row fails the batch is retried row by row and
+// only the failing rows are lost; they are counted and described in the
+// result. The returned error is reserved for the connection or context
+// giving out.
+func (r *ArticleRepository) AddBatch(ctx context.Context, articles []models.Article) (models.BatchResult, error) {
+	var result models.BatchResult
+	if len(articles) == 0 {
+		return result, nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, article := range articles {
+		batch.Queue(insertArticleQuery, articleArgs(article)...)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	inserted := 0
+	var batchErr error
+	for range articles {
+		tag, err := results.Exec()
+		if err != nil {
+			batchErr = err
+			break
+		}
+		inserted += int(tag.RowsAffected())
+	}
+	if err := results.Close(); err != nil && batchErr == nil {
+		batchErr = err
+	}
+	if batchErr == nil {
+		result.New = inserted
+		result.Duplicates = len(articles) - inserted
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+
+	for _, article := range articles {
+		tag, err := r.db.Exec(ctx, insertArticleQuery, articleArgs(article)...)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Errorf("article %q: %w", article.Link, err))
+		case tag.RowsAffected() > 0:
+			result.New++
+		default:
+			result.Duplicates++
+		}
+	}
+	return result, nil
+}
+
+// RecentTitles returns the titles, GUIDs and canonical links of the articles
+// stored for a source since the given time, for the re-publication check.
+func (r *ArticleRepository) RecentTitles(ctx context.Context, sourceID int64, since time.Time) ([]models.Article, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT title, guid, canonical_link FROM articles WHERE source_id = $1 AND published_at >= $2::timestamp`,
+		sourceID,
+		since.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []models.Article
+	for rows.Next() {
+		article := models.Article{SourceID: sourceID}
+		if err = rows.Scan(&article.Title, &article.GUID, &article.CanonicalLink); err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// KnownLinks reports which of the canonical links are already stored.
+func (r *ArticleRepository) KnownLinks(ctx context.Context, canonicalLinks []string) (map[string]bool, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT canonical_link FROM articles WHERE canonical_link = ANY($1)`,
+		canonicalLinks,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool)
+	for rows.Next() {
+		var link string
+		if err = rows.Scan(&link); err != nil {
+			return nil, err
+		}
+		known[link] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
 func (r *ArticleRepository) GetAll(ctx context.Context) ([]models.Article, error) {
 	query := `SELECT source_id, title, link, published_at FROM articles`
 	rows, err := r.db.Query(ctx, query)
@@ -53,15 +195,28 @@ func (r *ArticleRepository) GetAll(ctx context.Context) ([]models.Article, error
 	return articles, nil
 }
 
-func (r *ArticleRepository) GetAllNotPostedByUserSources(ctx context.Context, userID int64) ([]models.Article, error) {
+// GetUndelivered returns the best-ranked articles of the user's sources
+// that have not been delivered to the user yet. Failed deliveries come back
+// until they run out of attempts.
+//
+// Articles are ranked newest first, with every point of source priority
+// plus the user's weight for the source counting as priorityStep of
+// freshness. That is a score of 2^(priority+weight) decaying by half every
+// priorityStep of age, kept as a plain timestamp so it sorts in SQL.
+func (r *ArticleRepository) GetUndelivered(ctx context.Context, userID int64, limit int, priorityStep time.Duration) ([]models.Article, error) {
 	query := `
-		SELECT a.id, a.source_id, a.title, a.link, a.published_at 
+		SELECT a.id, a.source_id, a.title, a.link, a.published_at
 		FROM articles a
 		JOIN subscriptions s ON a.source_id = s.source_id
-		WHERE a.posted_at IS NULL AND s.user_id = $1
-		ORDER BY RANDOM()
+		JOIN sources src ON src.id = a.source_id
+		LEFT JOIN deliveries d ON d.article_id = a.id AND d.user_id = s.user_id
+		WHERE s.user_id = $1
+		  AND a.first_seen_at >= s.subscribed_at - INTERVAL '24 hours'
+		  AND (d.article_id IS NULL OR (d.status = 'failed' AND d.attempts < $2))
+		ORDER BY a.published_at + (src.priority + s.weight) * $4::float8 * INTERVAL '1 second' DESC, a.id DESC
+		LIMIT $3
 	`
-	rows, err := r.db.Query(ctx, query, userID)
+	rows, err := r.db.Query(ctx, query, userID, maxDeliveryAttempts, limit, priorityStep.Seconds())
 	if err != nil {
 		return nil, err
 	}
@@ -82,16 +237,3 @@ func (r *ArticleRepository) GetAllNotPostedByUserSources(ctx context.Context, us
 
 	return articles, nil
 }
-func (r *ArticleRepository) MarkAsPosted(ctx context.Context, article models.Article) error {
-	log.Print(article.ID)
-	_, err := r.db.Exec(ctx,
-		`UPDATE articles SET posted_at = $1::timestamp WHERE id = $2;`,
-		time.Now().UTC(),
-		article.ID,
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/jackc/pgx/v5/pgtype"
+	"testing"
+	"time"
+)
+
+// TestArticleArgsWithoutCategoriesAndEnclosures encodes the arguments the
+// way pgx sends them: an item with neither field must not bind NULL to the
+// NOT NULL columns.
+func TestArticleArgsWithoutCategoriesAndEnclosures(t *testing.T) {
+	args := articleArgs(models.Article{
+		SourceID:    1,
+		Title:       "Scraped item",
+		Link:        "https://example.com/1",
+		PublishedAt: time.Now(),
+		FirstSeenAt: time.Now(),
+	})
+
+	m := pgtype.NewMap()
+	tests := []struct {
+		column string
+		arg    any
+		oid    uint32
+		want   string
+	}{
+		{"categories", args[8], pgtype.TextArrayOID, "{}"},
+		{"enclosures", args[9], pgtype.JSONBOID, "[]"},
+	}
+	for _, tt := range tests {
+		buf, err := m.Encode(tt.oid, pgtype.TextFormatCode, tt.arg, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.column, err)
+		}
+		if buf == nil {
+			t.Errorf("%s is bound as NULL", tt.column)
+		} else if string(buf) != tt.want {
+			t.Errorf("%s = %s, want %s", tt.column, buf, tt.want)
+		}
+	}
+}
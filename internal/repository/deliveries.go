@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// maxDeliveryAttempts is how many times an article is tried for a user
+// before it is given up on.
+const maxDeliveryAttempts = 3
+
+type DeliveryRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewDeliveryRepository(db *pgxpool.Pool) *DeliveryRepository {
+	return &DeliveryRepository{db: db}
+}
+
+// Reserve claims an article for delivery to a user before it is sent. It
+// reports false when the article was delivered, is being delivered or has
+// run out of attempts. A delivery interrupted between Reserve and
+// MarkSent stays pending and is not retried: a lost message is preferred
+// over a duplicate.
+func (r *DeliveryRepository) Reserve(ctx context.Context, userID, articleID int64) (bool, error) {
+	query := `INSERT INTO deliveries (user_id, article_id, status, attempts, updated_at)
+			  VALUES ($1, $2, 'pending', 1, $3::timestamp)
+			  ON CONFLICT (user_id, article_id) DO UPDATE
+			  SET status = 'pending', attempts = deliveries.attempts + 1, updated_at = $3::timestamp
+			  WHERE deliveries.status = 'failed' AND deliveries.attempts < $4
+			  RETURNING attempts`
+	var attempts int
+	err := r.db.QueryRow(ctx, query, userID, articleID, time.Now().UTC(), maxDeliveryAttempts).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *DeliveryRepository) MarkSent(ctx context.Context, userID, articleID int64, messageID int) error {
+	query := `UPDATE deliveries
+			  SET status = 'sent', message_id = $1, error = '', updated_at = $2::timestamp
+			  WHERE user_id = $3 AND article_id = $4`
+	_, err := r.db.Exec(ctx, query, messageID, time.Now().UTC(), userID, articleID)
+	return err
+}
+
+func (r *DeliveryRepository) MarkFailed(ctx context.Context, userID, articleID int64, reason string) error {
+	query := `UPDATE deliveries
+			  SET status = 'failed', error = $1, updated_at = $2::timestamp
+			  WHERE user_id = $3 AND article_id = $4`
+	_, err := r.db.Exec(ctx, query, cleanText(reason), time.Now().UTC(), userID, articleID)
+	return err
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runsPerSource is how many runs are kept for each source.
+const runsPerSource = 500
+
+type FetchRunRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewFetchRunRepository(db *pgxpool.Pool) *FetchRunRepository {
+	return &FetchRunRepository{db: db}
+}
+
+// Record stores a run and drops the oldest runs of the source beyond the
+// retention limit.
+func (r *FetchRunRepository) Record(ctx context.Context, run models.FetchRun) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO fetch_runs (source_id, started_at, finished_at, http_status, items, new, duplicates, title_duplicates, filtered, error)
+		 VALUES ($1, $2::timestamp, $3::timestamp, $4, $5, $6, $7, $8, $9, $10)`,
+		run.SourceID,
+		run.StartedAt.UTC(),
+		run.FinishedAt.UTC(),
+		run.HTTPStatus,
+		run.Items,
+		run.New,
+		run.Duplicates,
+		run.TitleDuplicates,
+		run.Filtered,
+		cleanText(run.Error),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(ctx,
+		`DELETE FROM fetch_runs
+		 WHERE source_id = $1 AND id < (
+			 SELECT MIN(id) FROM (
+				 SELECT id FROM fetch_runs WHERE source_id = $1 ORDER BY id DESC LIMIT $2
+			 ) newest
+		 )`,
+		run.SourceID,
+		runsPerSource,
+	)
+	return err
+}
+
+// Recent returns the latest runs of a source, newest first.
+func (r *FetchRunRepository) Recent(ctx context.Context, sourceID int64, limit int) ([]models.FetchRun, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id, source_id, started_at, finished_at, http_status, items, new, duplicates, title_duplicates, filtered, error
+		 FROM fetch_runs
+		 WHERE source_id = $1
+		 ORDER BY started_at DESC, id DESC
+		 LIMIT $2`,
+		sourceID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.FetchRun
+	for rows.Next() {
+		var run models.FetchRun
+		if err = rows.Scan(&run.ID, &run.SourceID, &run.StartedAt, &run.FinishedAt, &run.HTTPStatus,
+			&run.Items, &run.New, &run.Duplicates, &run.TitleDuplicates, &run.Filtered, &run.Error); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
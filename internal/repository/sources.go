@@ -2,10 +2,19 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
 )
 
+const sourceColumns = `id, name, type, feed_url, priority, filters, proxy, options, etag, last_modified,
+	fetch_interval_seconds, pinned_interval_seconds, next_fetch_at,
+	last_success_at, last_error_at, last_error, consecutive_failures, avg_latency_ms, disabled, disabled_at,
+	websub_hub, websub_topic, websub_secret, websub_requested_at, websub_lease_expires_at,
+	created_at`
+
 type SourceRepository struct {
 	db *pgxpool.Pool
 }
@@ -14,30 +23,223 @@ func NewSourceRepository(db *pgxpool.Pool) *SourceRepository {
 	return &SourceRepository{db: db}
 }
 
-func (r *SourceRepository) Add(ctx context.Context, source models.Source) error {
-	query := `INSERT INTO sources(name, feed_url, priority, created_at)
-			  VALUES($1, $2, $3, $4)
-			  `
-	_, err := r.db.Exec(ctx, query, source.Name, source.FeedURL, source.Priority, source.CreatedAt)
+// Add stores a source and returns its ID. A source with the same feed URL
+// is reused, so adding a feed twice does not create duplicates.
+func (r *SourceRepository) Add(ctx context.Context, source models.Source) (int64, error) {
+	if source.Type == "" {
+		source.Type = models.SourceTypeRSS
+	}
+	// The no-op update makes RETURNING give the existing row's ID as well.
+	query := `INSERT INTO sources(name, type, feed_url, priority, filters, options, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT (feed_url) DO UPDATE SET feed_url = EXCLUDED.feed_url
+			  RETURNING id`
+	var id int64
+	err := r.db.QueryRow(ctx, query, source.Name, source.Type, source.FeedURL, source.Priority, source.Filters, source.Options, source.CreatedAt).Scan(&id)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
 func (r *SourceRepository) Sources(ctx context.Context) ([]models.Source, error) {
-	query := `SELECT  id, name, feed_url, priority, created_at FROM sources`
+	query := `SELECT ` + sourceColumns + ` FROM sources`
 	rows, err := r.db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	return scanSources(rows)
+}
+
+// Source returns a single source by ID.
+func (r *SourceRepository) Source(ctx context.Context, sourceID int64) (models.Source, error) {
+	query := `SELECT ` + sourceColumns + ` FROM sources WHERE id = $1`
+	rows, err := r.db.Query(ctx, query, sourceID)
+	if err != nil {
+		return models.Source{}, err
+	}
+	sources, err := scanSources(rows)
+	if err != nil {
+		return models.Source{}, err
+	}
+	if len(sources) == 0 {
+		return models.Source{}, fmt.Errorf("source %d: %w", sourceID, pgx.ErrNoRows)
+	}
+	return sources[0], nil
+}
+
+// DueSources returns the sources whose next scheduled fetch is not later than now.
+func (r *SourceRepository) DueSources(ctx context.Context, now time.Time) ([]models.Source, error) {
+	query := `SELECT ` + sourceColumns + ` FROM sources WHERE NOT disabled AND next_fetch_at <= $1::timestamp`
+	rows, err := r.db.Query(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanSources(rows)
+}
+
+func (r *SourceRepository) SetValidators(ctx context.Context, sourceID int64, etag, lastModified string) error {
+	query := `UPDATE sources SET etag = $1, last_modified = $2 WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, etag, lastModified, sourceID)
+	return err
+}
+
+func (r *SourceRepository) SetSchedule(ctx context.Context, sourceID int64, interval time.Duration, nextFetchAt time.Time) error {
+	query := `UPDATE sources SET fetch_interval_seconds = $1, next_fetch_at = $2::timestamp WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, int64(interval/time.Second), nextFetchAt.UTC(), sourceID)
+	return err
+}
+
+// PinInterval fixes the polling interval of a source; a zero interval
+// returns the source to adaptive scheduling. The source is fetched on the
+// next scheduler tick either way.
+func (r *SourceRepository) PinInterval(ctx context.Context, sourceID int64, interval time.Duration) error {
+	query := `UPDATE sources
+			  SET pinned_interval_seconds = $1,
+			      fetch_interval_seconds = CASE WHEN $1 > 0 THEN $1 ELSE fetch_interval_seconds END,
+			      next_fetch_at = $2::timestamp
+			  WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, int64(interval/time.Second), time.Now().UTC(), sourceID)
+	return err
+}
+
+// SetPriority sets how strongly the articles of a source are preferred
+// when deliveries are ranked.
+func (r *SourceRepository) SetPriority(ctx context.Context, sourceID int64, priority int) error {
+	query := `UPDATE sources SET priority = $1 WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, priority, sourceID)
+	return err
+}
+
+// SetProxy sets the proxy the source is fetched through; an empty proxy
+// means the global one.
+func (r *SourceRepository) SetProxy(ctx context.Context, sourceID int64, proxy string) error {
+	query := `UPDATE sources SET proxy = $1 WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, proxy, sourceID)
+	return err
+}
+
+// RecordSuccess resets the failure streak and folds the latency into the
+// moving average.
+func (r *SourceRepository) RecordSuccess(ctx context.Context, sourceID int64, latency time.Duration) error {
+	query := `UPDATE sources
+			  SET last_success_at = $1::timestamp,
+			      consecutive_failures = 0,
+			      avg_latency_ms = ` + avgLatencyExpr + `
+			  WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, time.Now().UTC(), latency.Milliseconds(), sourceID)
+	return err
+}
+
+// RecordFailure stores the error and returns the new number of consecutive failures.
+func (r *SourceRepository) RecordFailure(ctx context.Context, sourceID int64, reason string, latency time.Duration) (int, error) {
+	query := `UPDATE sources
+			  SET last_error_at = $1::timestamp,
+			      last_error = $4,
+			      consecutive_failures = consecutive_failures + 1,
+			      avg_latency_ms = ` + avgLatencyExpr + `
+			  WHERE id = $3
+			  RETURNING consecutive_failures`
+	var failures int
+	err := r.db.QueryRow(ctx, query, time.Now().UTC(), latency.Milliseconds(), sourceID, reason).Scan(&failures)
+	return failures, err
+}
+
+func (r *SourceRepository) Disable(ctx context.Context, sourceID int64) error {
+	query := `UPDATE sources SET disabled = TRUE, disabled_at = $1::timestamp WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, time.Now().UTC(), sourceID)
+	return err
+}
+
+// Enable puts a disabled source back into rotation with a clean failure streak.
+func (r *SourceRepository) Enable(ctx context.Context, sourceID int64) error {
+	query := `UPDATE sources
+			  SET disabled = FALSE, disabled_at = NULL, consecutive_failures = 0, next_fetch_at = $1::timestamp
+			  WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, time.Now().UTC(), sourceID)
+	return err
+}
+
+// SetWebSubHub stores the hub a feed advertises. A different hub or topic
+// drops the previous subscription state.
+func (r *SourceRepository) SetWebSubHub(ctx context.Context, sourceID int64, hub, topic string) error {
+	query := `UPDATE sources
+			  SET websub_hub = $1, websub_topic = $2, websub_secret = '',
+			      websub_requested_at = NULL, websub_lease_expires_at = NULL
+			  WHERE id = $3 AND (websub_hub <> $1 OR websub_topic <> $2)`
+	_, err := r.db.Exec(ctx, query, hub, topic, sourceID)
+	return err
+}
+
+// WebSubSources returns the enabled sources that advertise a hub.
+func (r *SourceRepository) WebSubSources(ctx context.Context) ([]models.Source, error) {
+	query := `SELECT ` + sourceColumns + ` FROM sources WHERE NOT disabled AND websub_hub <> ''`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanSources(rows)
+}
+
+// SetWebSubRequested records a subscription request and the secret it used.
+func (r *SourceRepository) SetWebSubRequested(ctx context.Context, sourceID int64, secret string, requestedAt time.Time) error {
+	query := `UPDATE sources SET websub_secret = $1, websub_requested_at = $2::timestamp WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, secret, requestedAt.UTC(), sourceID)
+	return err
+}
+
+// SetWebSubLease stores when a verified subscription expires; a zero time
+// marks the source as not subscribed.
+func (r *SourceRepository) SetWebSubLease(ctx context.Context, sourceID int64, expiresAt time.Time) error {
+	var lease *time.Time
+	if !expiresAt.IsZero() {
+		utc := expiresAt.UTC()
+		lease = &utc
+	}
+	query := `UPDATE sources SET websub_lease_expires_at = $1::timestamp WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, lease, sourceID)
+	return err
+}
+
+// avgLatencyExpr is an exponential moving average with weight 1/5 for the
+// newest sample ($2, in milliseconds).
+const avgLatencyExpr = `CASE WHEN avg_latency_ms = 0 THEN $2 ELSE (avg_latency_ms * 4 + $2) / 5 END`
+
+func derefTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func scanSources(rows pgx.Rows) ([]models.Source, error) {
 	defer rows.Close()
 	var sources []models.Source
 	for rows.Next() {
-		var source models.Source
-		if err := rows.Scan(&source.ID, &source.Name, &source.FeedURL, &source.Priority, &source.CreatedAt); err != nil {
+		var (
+			source                                 models.Source
+			fetchSecs, pinnedSecs, latencyMs       int64
+			lastSuccessAt, lastErrorAt, disabledAt *time.Time
+			requestedAt, leaseExpiresAt            *time.Time
+		)
+		if err := rows.Scan(
+			&source.ID, &source.Name, &source.Type, &source.FeedURL, &source.Priority, &source.Filters, &source.Proxy, &source.Options,
+			&source.ETag, &source.LastModified, &fetchSecs, &pinnedSecs, &source.NextFetchAt,
+			&lastSuccessAt, &lastErrorAt, &source.Health.LastError, &source.Health.ConsecutiveFailures,
+			&latencyMs, &source.Health.Disabled, &disabledAt,
+			&source.WebSub.Hub, &source.WebSub.Topic, &source.WebSub.Secret, &requestedAt, &leaseExpiresAt,
+			&source.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
+		source.FetchInterval = time.Duration(fetchSecs) * time.Second
+		source.PinnedInterval = time.Duration(pinnedSecs) * time.Second
+		source.Health.AvgLatency = time.Duration(latencyMs) * time.Millisecond
+		source.Health.LastSuccessAt = derefTime(lastSuccessAt)
+		source.Health.LastErrorAt = derefTime(lastErrorAt)
+		source.Health.DisabledAt = derefTime(disabledAt)
+		source.WebSub.RequestedAt = derefTime(requestedAt)
+		source.WebSub.LeaseExpiresAt = derefTime(leaseExpiresAt)
 		sources = append(sources, source)
 	}
 	if err := rows.Err(); err != nil {
@@ -18,6 +18,7 @@ func (r *SubscriptionRepository) Add(ctx context.Context, userId int64, sourceId
 	query := `
 	INSERT INTO subscriptions (user_id, source_id) 
 	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
 	`
 	_, err := r.db.Exec(ctx, query, userId, sourceId)
 	if err != nil {
@@ -26,6 +27,57 @@ func (r *SubscriptionRepository) Add(ctx context.Context, userId int64, sourceId
 	return nil
 }
 
+// SetCategory files a subscription under a category.
+func (r *SubscriptionRepository) SetCategory(ctx context.Context, userID int64, sourceID int64, category string) error {
+	query := `UPDATE subscriptions SET category = $1 WHERE user_id = $2 AND source_id = $3`
+	_, err := r.db.Exec(ctx, query, category, userID, sourceID)
+	return err
+}
+
+// SetWeight sets the user's weight for a source. It reports false when the
+// user is not subscribed to the source.
+func (r *SubscriptionRepository) SetWeight(ctx context.Context, userID int64, sourceID int64, weight int) (bool, error) {
+	query := `UPDATE subscriptions SET weight = $1 WHERE user_id = $2 AND source_id = $3`
+	tag, err := r.db.Exec(ctx, query, weight, userID, sourceID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetSubscriptionsByUserID returns the user's subscriptions with their
+// categories and weights.
+func (r *SubscriptionRepository) GetSubscriptionsByUserID(ctx context.Context, userID int64) ([]models.Subscription, error) {
+	query := `
+        SELECT s.id, s.name, s.type, s.feed_url, s.priority, s.created_at, sub.category, sub.weight
+        FROM subscriptions sub
+        JOIN sources s ON sub.source_id = s.id
+        WHERE sub.user_id = $1
+        ORDER BY sub.category, s.name;
+    `
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		var sub models.Subscription
+		if err := rows.Scan(&sub.Source.ID, &sub.Source.Name, &sub.Source.Type, &sub.Source.FeedURL, &sub.Source.Priority, &sub.Source.CreatedAt, &sub.Category, &sub.Weight); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
 func (r *SubscriptionRepository) GetSourcesByUserID(ctx context.Context, userID int64) ([]models.Source, error) {
 	query := `
         SELECT s.id, s.name, s.feed_url, s.priority, s.created_at
@@ -55,3 +107,33 @@ func (r *SubscriptionRepository) GetSourcesByUserID(ctx context.Context, userID
 
 	return sources, nil
 }
+
+func (r *SubscriptionRepository) GetUserIDsBySourceID(ctx context.Context, sourceID int64) ([]int64, error) {
+	query := `
+		SELECT sub.user_id
+		FROM subscriptions sub
+		JOIN users u ON u.tg_id = sub.user_id
+		WHERE sub.source_id = $1 AND u.active
+	`
+
+	rows, err := r.db.Query(ctx, query, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
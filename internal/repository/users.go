@@ -2,10 +2,15 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	models "github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
 )
 
+const userColumns = `tg_id, username, delivery_mode, digest_minute, digest_weekday, timezone, last_digest_at`
+
 type UsersRepository struct {
 	db *pgxpool.Pool
 }
@@ -15,25 +20,111 @@ func NewUsersRepository(db *pgxpool.Pool) *UsersRepository {
 
 }
 
+// GetAllUsers returns the users that can be sent to.
 func (r *UsersRepository) GetAllUsers(ctx context.Context) ([]models.TgUser, error) {
-	query := `SELECT tg_id, username FROM users`
+	query := `SELECT ` + userColumns + ` FROM users WHERE active`
 	rows, err := r.db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	return scanUsers(rows)
+}
+
+func (r *UsersRepository) GetUser(ctx context.Context, userID int64) (models.TgUser, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE tg_id = $1`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return models.TgUser{}, err
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return models.TgUser{}, err
+	}
+	if len(users) == 0 {
+		return models.TgUser{}, fmt.Errorf("user %d: %w", userID, pgx.ErrNoRows)
+	}
+	return users[0], nil
+}
+
+// AddTgUser adds a user, or reactivates a known one.
+func (r *UsersRepository) AddTgUser(ctx context.Context, tgUser models.TgUser) error {
+	query := `INSERT INTO users (tg_id, username) VALUES ($1, $2)
+			  ON CONFLICT (tg_id) DO UPDATE
+			  SET username = EXCLUDED.username, active = true, inactive_reason = '', inactive_since = NULL`
+	_, err := r.db.Exec(ctx, query, tgUser.TgId, tgUser.Username)
+	return err
+}
+
+// Deactivate stops sending to a user until they run /start again.
+func (r *UsersRepository) Deactivate(ctx context.Context, userID int64, reason string) error {
+	query := `UPDATE users SET active = false, inactive_reason = $1, inactive_since = $2::timestamp WHERE tg_id = $3`
+	_, err := r.db.Exec(ctx, query, reason, time.Now().UTC(), userID)
+	return err
+}
+
+// MigrateChat moves a group that became a supergroup to its new chat ID:
+// the user, the subscriptions and the delivery history are copied over and
+// the old chat is deactivated.
+func (r *UsersRepository) MigrateChat(ctx context.Context, oldID, newID int64) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		queries := []string{
+			`INSERT INTO users (tg_id, username, delivery_mode, digest_minute, digest_weekday, timezone, last_digest_at)
+			 SELECT $2, username, delivery_mode, digest_minute, digest_weekday, timezone, last_digest_at
+			 FROM users WHERE tg_id = $1
+			 ON CONFLICT (tg_id) DO UPDATE SET active = true, inactive_reason = '', inactive_since = NULL`,
+			`INSERT INTO subscriptions (user_id, source_id, category, weight, subscribed_at)
+			 SELECT $2, source_id, category, weight, subscribed_at
+			 FROM subscriptions WHERE user_id = $1
+			 ON CONFLICT DO NOTHING`,
+			`INSERT INTO deliveries (user_id, article_id, status, message_id, attempts, error, updated_at)
+			 SELECT $2, article_id, status, message_id, attempts, error, updated_at
+			 FROM deliveries WHERE user_id = $1
+			 ON CONFLICT DO NOTHING`,
+		}
+		for _, query := range queries {
+			if _, err := tx.Exec(ctx, query, oldID, newID); err != nil {
+				return err
+			}
+		}
+		query := `UPDATE users SET active = false, inactive_reason = 'migrated', inactive_since = $1::timestamp WHERE tg_id = $2`
+		_, err := tx.Exec(ctx, query, time.Now().UTC(), oldID)
+		return err
+	})
+}
+
+// SetDeliverySettings changes how a user gets articles. The digest clock
+// starts now, so switching to digests does not send one right away.
+func (r *UsersRepository) SetDeliverySettings(ctx context.Context, userID int64, settings models.DeliverySettings) error {
+	query := `UPDATE users
+			  SET delivery_mode = $1, digest_minute = $2, digest_weekday = $3, timezone = $4, last_digest_at = $5::timestamp
+			  WHERE tg_id = $6`
+	_, err := r.db.Exec(ctx, query, settings.Mode, settings.Minute, settings.Weekday, settings.Timezone, time.Now().UTC(), userID)
+	return err
+}
+
+func (r *UsersRepository) MarkDigestSent(ctx context.Context, userID int64, sentAt time.Time) error {
+	query := `UPDATE users SET last_digest_at = $1::timestamp WHERE tg_id = $2`
+	_, err := r.db.Exec(ctx, query, sentAt.UTC(), userID)
+	return err
+}
+
+func scanUsers(rows pgx.Rows) ([]models.TgUser, error) {
+	defer rows.Close()
 	var users []models.TgUser
 	for rows.Next() {
-		var user models.TgUser
-		if err = rows.Scan(&user.TgId, &user.Username); err != nil {
+		var (
+			user         models.TgUser
+			lastDigestAt *time.Time
+		)
+		if err := rows.Scan(&user.TgId, &user.Username, &user.Delivery.Mode, &user.Delivery.Minute, &user.Delivery.Weekday,
+			&user.Delivery.Timezone, &lastDigestAt); err != nil {
 			return nil, err
 		}
+		user.Delivery.LastDigestAt = derefTime(lastDigestAt)
 		users = append(users, user)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
-
-func (r *UsersRepository) AddTgUser(ctx context.Context, tgUser models.TgUser) error {
-	query := `INSERT INTO users (tg_id, username) VALUES ($1, $2)`
-	_, err := r.db.Exec(ctx, query, tgUser.TgId, tgUser.Username)
-	return err
-}
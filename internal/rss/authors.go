@@ -0,0 +1,85 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+const dublinCoreNS = "http://purl.org/dc/elements/1.1/"
+
+// itemAuthors extracts per-item authors, which the feed parser does not
+// expose. Authors are keyed by GUID (or Atom id) and by link, matching how
+// the parser assigns rss.Item.ID. RSS <author>, <dc:creator> and Atom
+// <author><name> are recognised.
+func itemAuthors(body []byte) map[string]string {
+	authors := make(map[string]string)
+
+	var (
+		inItem, inAtomAuthor bool
+		id, link, author     string
+	)
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return authors
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			local := t.Name.Local
+			if local == "item" || local == "entry" {
+				inItem, inAtomAuthor = true, false
+				id, link, author = "", "", ""
+				continue
+			}
+			if !inItem {
+				continue
+			}
+
+			var value string
+			switch {
+			case local == "guid" || (local == "id" && !inAtomAuthor):
+				if dec.DecodeElement(&value, &t) == nil {
+					id = strings.TrimSpace(value)
+				}
+			case local == "link":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "href" && link == "" {
+						link = attr.Value
+					}
+				}
+				if dec.DecodeElement(&value, &t) == nil && link == "" {
+					link = strings.TrimSpace(value)
+				}
+			case local == "author" && t.Name.Space == "http://www.w3.org/2005/Atom":
+				inAtomAuthor = true
+			case local == "name" && inAtomAuthor:
+				if dec.DecodeElement(&value, &t) == nil && author == "" {
+					author = strings.TrimSpace(value)
+				}
+			case local == "author" || (local == "creator" && t.Name.Space == dublinCoreNS):
+				if dec.DecodeElement(&value, &t) == nil && author == "" {
+					author = strings.TrimSpace(value)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "author":
+				inAtomAuthor = false
+			case "item", "entry":
+				inItem = false
+				if author == "" {
+					continue
+				}
+				if id != "" {
+					authors[id] = author
+				}
+				if link != "" {
+					authors[link] = author
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const syndicationNS = "http://purl.org/rss/1.0/modules/syndication/"
+
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// refreshHint reads the polling interval the publisher asks for, either as
+// an RSS <ttl> in minutes or as sy:updatePeriod/sy:updateFrequency. Only the
+// feed header is scanned; it returns zero when the feed gives no hint.
+func refreshHint(body []byte) time.Duration {
+	var (
+		ttl       time.Duration
+		period    time.Duration
+		frequency = 1
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "item" || start.Name.Local == "entry" {
+			break
+		}
+
+		var value string
+		switch {
+		case start.Name.Local == "ttl" && start.Name.Space == "":
+			if dec.DecodeElement(&value, &start) == nil {
+				if minutes, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && minutes > 0 {
+					ttl = time.Duration(minutes) * time.Minute
+				}
+			}
+		case start.Name.Local == "updatePeriod" && start.Name.Space == syndicationNS:
+			if dec.DecodeElement(&value, &start) == nil {
+				period = updatePeriods[strings.ToLower(strings.TrimSpace(value))]
+			}
+		case start.Name.Local == "updateFrequency" && start.Name.Space == syndicationNS:
+			if dec.DecodeElement(&value, &start) == nil {
+				if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n > 0 {
+					frequency = n
+				}
+			}
+		}
+	}
+
+	if period > 0 {
+		if hint := period / time.Duration(frequency); hint > ttl {
+			return hint
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,85 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+// feedLinks reads the WebSub hub and self links from the feed header:
+// <link rel="hub"> in Atom and <atom:link rel="hub"> in RSS.
+func feedLinks(body []byte) (hub, self string) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return hub, self
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "item" || start.Name.Local == "entry" {
+			return hub, self
+		}
+		if start.Name.Local != "link" {
+			continue
+		}
+
+		var rel, href string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = strings.ToLower(strings.TrimSpace(attr.Value))
+			case "href":
+				href = strings.TrimSpace(attr.Value)
+			}
+		}
+		switch {
+		case rel == "hub" && hub == "":
+			hub = href
+		case rel == "self" && self == "":
+			self = href
+		}
+	}
+}
+
+// headerLinks reads the hub and self links from HTTP Link headers such as
+// `<https://hub.example/>; rel="hub"`.
+func headerLinks(header http.Header) (hub, self string) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = target[1 : len(target)-1]
+			for _, param := range parts[1:] {
+				name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || strings.ToLower(name) != "rel" {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.ToLower(strings.Trim(value, `"`))) {
+					switch {
+					case rel == "hub" && hub == "":
+						hub = target
+					case rel == "self" && self == "":
+						self = target
+					}
+				}
+			}
+		}
+	}
+	return hub, self
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
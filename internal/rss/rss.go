@@ -2,71 +2,177 @@ package rss
 
 import (
 	"context"
+	"fmt"
 	"github.com/Frozelo/FeedBackManagerBot/internal/model"
 	"github.com/SlyMarbo/rss"
+	"io"
 	"log"
+	"net/http"
+	"time"
 )
 
 type RSS struct {
-	URL      string
-	SourceId int64
-	Name     string
+	URL          string
+	SourceId     int64
+	Name         string
+	ETag         string
+	LastModified string
+	Hint         time.Duration
+	Status       int
+
+	client  *http.Client
+	authors map[string]string
+
+	hub, topic string
+	linksRead  bool
 }
 
-func NewRSS(source models.Source) *RSS {
-	return &RSS{URL: source.FeedURL, SourceId: source.ID, Name: source.Name}
+func NewRSS(source models.Source, client *http.Client) *RSS {
+	return &RSS{
+		client:       client,
+		URL:          source.FeedURL,
+		SourceId:     source.ID,
+		Name:         source.Name,
+		ETag:         source.ETag,
+		LastModified: source.LastModified,
+	}
 }
 
 func (r *RSS) Id() int64 {
 	return r.SourceId
 }
 
+// Validators returns the HTTP cache validators from the latest response,
+// to be sent back with the next request for the feed.
+func (r *RSS) Validators() (etag, lastModified string) {
+	return r.ETag, r.LastModified
+}
+
+// StatusCode returns the HTTP status of the latest feed response.
+func (r *RSS) StatusCode() int {
+	return r.Status
+}
+
+// RefreshHint returns the polling interval requested by the feed itself.
+func (r *RSS) RefreshHint() time.Duration {
+	return r.Hint
+}
+
 func (r *RSS) Fetch(ctx context.Context) (*[]models.Item, error) {
-	feed, err := loadFeed(ctx, r.URL)
+	feed, err := r.loadFeed(ctx)
 	if err != nil {
 		log.Printf("[ERROR] failed to load feed from %q: %v", r.URL, err)
 		return nil, err
 	}
+	if feed == nil {
+		log.Printf("[INFO] feed %q not modified", r.URL)
+		return &[]models.Item{}, nil
+	}
+
+	return r.items(feed), nil
+}
+
+// ParsePush turns a feed document pushed by a WebSub hub into items.
+func (r *RSS) ParsePush(body []byte) (*[]models.Item, error) {
+	feed, err := rss.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	r.authors = itemAuthors(body)
+	return r.items(feed), nil
+}
 
+// Hub returns the WebSub hub and topic advertised with the latest feed
+// response. ok is false when the feed was not downloaded, e.g. on a 304.
+func (r *RSS) Hub() (hub, topic string, ok bool) {
+	return r.hub, r.topic, r.linksRead
+}
+
+func (r *RSS) items(feed *rss.Feed) *[]models.Item {
 	var items []models.Item
 	for _, item := range feed.Items {
 		itemArticle := r.createItem(item)
 		items = append(items, itemArticle)
 	}
-	return &items, nil
+	return &items
 }
 
 func (r *RSS) createItem(item *rss.Item) models.Item {
+	var enclosures []models.Enclosure
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		enclosures = append(enclosures, models.Enclosure{
+			URL:    enclosure.URL,
+			Type:   enclosure.Type,
+			Length: int64(enclosure.Length),
+		})
+	}
+
+	author := r.authors[item.ID]
+	if author == "" {
+		author = r.authors[item.Link]
+	}
+
 	return models.Item{
+		GUID:       item.ID,
 		Title:      item.Title,
 		Categories: item.Categories,
 		Link:       item.Link,
 		Date:       item.Date,
+		Summary:    item.Summary,
+		Content:    item.Content,
+		Author:     author,
+		Enclosures: enclosures,
 	}
 }
 
-func loadFeed(ctx context.Context, url string) (*rss.Feed, error) {
-	feedCh := make(chan *rss.Feed)
-	errCh := make(chan error)
+// loadFeed performs a conditional GET for the feed. It returns a nil feed
+// without error when the server answers 304 Not Modified.
+func (r *RSS) loadFeed(ctx context.Context) (*rss.Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.ETag != "" {
+		req.Header.Set("If-None-Match", r.ETag)
+	}
+	if r.LastModified != "" {
+		req.Header.Set("If-Modified-Since", r.LastModified)
+	}
 
-	go func() {
-		feed, err := rss.Fetch(url)
-		if err != nil {
-			errCh <- err
-			return
-		}
-		feedCh <- feed
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	r.Status = resp.StatusCode
 
-	}()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-errCh:
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	feed, err := rss.Parse(body)
+	if err != nil {
 		return nil, err
-	case feed := <-feedCh:
-		return feed, nil
-
 	}
 
+	r.Hint = refreshHint(body)
+	r.authors = itemAuthors(body)
+	headerHub, headerSelf := headerLinks(resp.Header)
+	bodyHub, bodySelf := feedLinks(body)
+	r.hub = firstNonEmpty(headerHub, bodyHub)
+	r.topic = firstNonEmpty(headerSelf, bodySelf, r.URL)
+	r.linksRead = true
+	r.ETag = resp.Header.Get("ETag")
+	r.LastModified = resp.Header.Get("Last-Modified")
+	return feed, nil
 }
@@ -0,0 +1,38 @@
+package sanitize
+
+import (
+	"github.com/microcosm-cc/bluemonday"
+	"html"
+	"strings"
+)
+
+var (
+	richPolicy   = newRichPolicy()
+	strictPolicy = bluemonday.StrictPolicy()
+)
+
+// newRichPolicy keeps basic formatting, lists, quotes, links and images.
+// Scripts, styles, event handlers and non-http(s) URLs are removed.
+func newRichPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowElements(
+		"p", "br", "b", "strong", "i", "em", "u", "s", "del",
+		"ul", "ol", "li", "blockquote", "code", "pre",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+	)
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("src", "alt").OnElements("img")
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// HTML reduces untrusted markup to the safe formatting subset.
+func HTML(s string) string {
+	return strings.TrimSpace(richPolicy.Sanitize(s))
+}
+
+// Text strips all markup and returns plain text.
+func Text(s string) string {
+	return strings.TrimSpace(html.UnescapeString(strictPolicy.Sanitize(s)))
+}
@@ -0,0 +1,137 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/dateparse"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Scraper is a Sourcer for sites without a feed: it extracts items from an
+// HTML page with the CSS selectors stored in the source options.
+type Scraper struct {
+	URL      string
+	SourceId int64
+	Name     string
+
+	opts   models.ScrapeOptions
+	client *http.Client
+	status int
+}
+
+func NewScraper(source models.Source, client *http.Client) (*Scraper, error) {
+	opts := source.Options.Scrape
+	if opts == nil || opts.Item == "" || opts.Title == "" {
+		return nil, fmt.Errorf("source %q needs item and title selectors", source.Name)
+	}
+	return &Scraper{
+		URL:      source.FeedURL,
+		SourceId: source.ID,
+		Name:     source.Name,
+		opts:     *opts,
+		client:   client,
+	}, nil
+}
+
+func (s *Scraper) Id() int64 {
+	return s.SourceId
+}
+
+// StatusCode returns the HTTP status of the latest response.
+func (s *Scraper) StatusCode() int {
+	return s.status
+}
+
+func (s *Scraper) Fetch(ctx context.Context) (*[]models.Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	s.status = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	base := resp.Request.URL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(href); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+
+	var items []models.Item
+	doc.Find(s.opts.Item).Each(func(_ int, sel *goquery.Selection) {
+		if item, ok := s.createItem(sel, base); ok {
+			items = append(items, item)
+		}
+	})
+	if len(items) == 0 {
+		return nil, fmt.Errorf("selector %q matched no items on %q", s.opts.Item, s.URL)
+	}
+	return &items, nil
+}
+
+func (s *Scraper) createItem(sel *goquery.Selection, base *url.URL) (models.Item, bool) {
+	title := strings.TrimSpace(find(sel, s.opts.Title).Text())
+
+	linkSel := find(sel, s.opts.Link)
+	if s.opts.Link == "" && !sel.Is("a") {
+		linkSel = sel.Find("a[href]").First()
+	}
+	var link string
+	if href, ok := linkSel.Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			link = base.ResolveReference(ref).String()
+		}
+	}
+	if title == "" || link == "" {
+		return models.Item{}, false
+	}
+
+	item := models.Item{
+		GUID:       link,
+		Title:      title,
+		Link:       link,
+		SourceName: s.Name,
+	}
+	if s.opts.Summary != "" {
+		if summary, err := find(sel, s.opts.Summary).Html(); err == nil {
+			item.Summary = summary
+		}
+	}
+	if s.opts.Date != "" {
+		dateSel := find(sel, s.opts.Date)
+		value, ok := dateSel.Attr("datetime")
+		if !ok {
+			value = dateSel.Text()
+		}
+		if date, err := dateparse.Parse(value, s.opts.DateLayout); err == nil {
+			item.Date = date
+		}
+	}
+	return item, true
+}
+
+// find applies a selector inside an item; an empty selector means the item
+// container itself.
+func find(sel *goquery.Selection, selector string) *goquery.Selection {
+	if selector == "" {
+		return sel
+	}
+	return sel.Find(selector).First()
+}
@@ -0,0 +1,131 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type Worker func(ctx context.Context) error
+
+// ErrFatal marks a worker error that must not be retried. Wrap it to stop
+// the whole supervisor.
+var ErrFatal = errors.New("fatal worker error")
+
+type worker struct {
+	name string
+	run  Worker
+}
+
+// Supervisor runs long-lived workers, restarts the ones that fail with an
+// exponential backoff and stops them all together when its context is done
+// or a worker fails fatally.
+type Supervisor struct {
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.Mutex
+	workers  []worker
+	restarts map[string]int
+}
+
+func New(minBackoff, maxBackoff time.Duration) *Supervisor {
+	return &Supervisor{
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		restarts:   make(map[string]int),
+	}
+}
+
+func (s *Supervisor) Add(name string, run Worker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers = append(s.workers, worker{name: name, run: run})
+}
+
+// Restarts returns how many times each worker has been restarted.
+func (s *Supervisor) Restarts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	restarts := make(map[string]int, len(s.restarts))
+	for name, count := range s.restarts {
+		restarts[name] = count
+	}
+	return restarts
+}
+
+// Run blocks until ctx is done and every worker has returned. It returns
+// the first fatal worker error, if any.
+func (s *Supervisor) Run(ctx context.Context) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	s.mu.Lock()
+	workers := append([]worker(nil), s.workers...)
+	s.mu.Unlock()
+
+	for _, w := range workers {
+		w := w
+		group.Go(func() error {
+			return s.supervise(groupCtx, w)
+		})
+	}
+	return group.Wait()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, w worker) error {
+	backoff := s.minBackoff
+	for {
+		started := time.Now()
+		err := runSafely(ctx, w)
+		if ctx.Err() != nil {
+			log.Printf("[INFO] %s stopped", w.name)
+			return nil
+		}
+		if errors.Is(err, ErrFatal) {
+			return fmt.Errorf("%s: %w", w.name, err)
+		}
+
+		// A worker that ran for a while before failing is not crash-looping,
+		// so it starts over from the shortest delay.
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+
+		s.mu.Lock()
+		s.restarts[w.name]++
+		restarts := s.restarts[w.name]
+		s.mu.Unlock()
+		log.Printf("[ERROR] %s failed: %v; restart #%d in %s", w.name, err, restarts, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("[INFO] %s stopped", w.name)
+			return nil
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func runSafely(ctx context.Context, w worker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	if err := w.run(ctx); err != nil {
+		return err
+	}
+	return errors.New("worker returned unexpectedly")
+}
@@ -0,0 +1,327 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLease = 7 * 24 * time.Hour
+	// renewBefore is how long before the lease runs out it is renewed.
+	renewBefore = time.Hour
+	// retryAfter is how long a subscription request may stay unverified
+	// before it is sent again.
+	retryAfter    = 15 * time.Minute
+	checkInterval = time.Minute
+	maxPushSize   = 10 << 20
+)
+
+type Config struct {
+	// Listen is the address the callback endpoint listens on, e.g. ":8080".
+	// WebSub is off when Listen or CallbackURL is empty.
+	Listen string `yaml:"listen"`
+	// CallbackURL is the public base URL the hubs reach Listen at.
+	CallbackURL string `yaml:"callbackURL"`
+	// Lease is the subscription lifetime asked of the hubs.
+	Lease time.Duration `yaml:"lease"`
+}
+
+type Store interface {
+	Source(ctx context.Context, sourceID int64) (models.Source, error)
+	WebSubSources(ctx context.Context) ([]models.Source, error)
+	SetWebSubRequested(ctx context.Context, sourceID int64, secret string, requestedAt time.Time) error
+	SetWebSubLease(ctx context.Context, sourceID int64, expiresAt time.Time) error
+}
+
+// Receiver takes the content pushed for a source.
+type Receiver interface {
+	Push(ctx context.Context, sourceID int64, body []byte) error
+}
+
+// Subscriber subscribes to the hubs that sources advertise, verifies the
+// hubs' challenges and hands pushed content to the receiver.
+type Subscriber struct {
+	cfg      Config
+	store    Store
+	clients  *httpclient.Factory
+	receiver Receiver
+}
+
+func New(cfg Config, store Store, clients *httpclient.Factory, receiver Receiver) *Subscriber {
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaultLease
+	}
+	cfg.CallbackURL = strings.TrimSuffix(cfg.CallbackURL, "/")
+	return &Subscriber{cfg: cfg, store: store, clients: clients, receiver: receiver}
+}
+
+func (s *Subscriber) Enabled() bool {
+	return s.cfg.Listen != "" && s.cfg.CallbackURL != ""
+}
+
+// Start serves the callback endpoint and keeps the subscriptions alive
+// until ctx is done.
+func (s *Subscriber) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.cfg.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	s.Renew(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			s.Renew(ctx)
+		case err := <-serveErr:
+			return fmt.Errorf("callback endpoint: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Handler serves the hub callbacks at /websub/{source id}.
+func (s *Subscriber) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /websub/{id}", s.verify)
+	mux.HandleFunc("POST /websub/{id}", s.receive)
+	return mux
+}
+
+// Renew subscribes the sources that are not subscribed yet and renews the
+// leases that are about to run out.
+func (s *Subscriber) Renew(ctx context.Context) {
+	sources, err := s.store.WebSubSources(ctx)
+	if err != nil {
+		log.Printf("[ERROR] failed to load WebSub sources: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, source := range sources {
+		if source.WebSub.LeaseExpiresAt.After(now.Add(renewBefore)) || source.WebSub.RequestedAt.After(now.Add(-retryAfter)) {
+			continue
+		}
+		if err := s.subscribe(ctx, source); err != nil {
+			log.Printf("[ERROR] failed to subscribe source %q at hub %q: %v", source.Name, source.WebSub.Hub, err)
+		}
+	}
+}
+
+func (s *Subscriber) subscribe(ctx context.Context, source models.Source) error {
+	secret := source.WebSub.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return err
+		}
+	}
+	// The hub may verify the intent before it answers, so the request has
+	// to be on record first.
+	if err := s.store.SetWebSubRequested(ctx, source.ID, secret, time.Now()); err != nil {
+		return err
+	}
+
+	// The hub is the one the feed advertises, so it has to be public.
+	client, err := s.clients.PublicClient(source.Proxy)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {source.WebSub.Topic},
+		"hub.callback":      {s.callbackURL(source.ID)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.FormatInt(int64(s.cfg.Lease/time.Second), 10)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, source.WebSub.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("hub answered %s: %s", resp.Status, strings.TrimSpace(string(reason)))
+	}
+	log.Printf("[INFO] requested WebSub subscription for source %q at hub %q", source.Name, source.WebSub.Hub)
+	return nil
+}
+
+func (s *Subscriber) callbackURL(sourceID int64) string {
+	return s.cfg.CallbackURL + "/websub/" + strconv.FormatInt(sourceID, 10)
+}
+
+// verify answers the hub's intent verification and denial notices.
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request) {
+	source, ok := s.source(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	topic := query.Get("hub.topic")
+	ours := source.WebSub.Hub != "" && topic == source.WebSub.Topic
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		if !ours || source.WebSub.RequestedAt.IsZero() {
+			http.NotFound(w, r)
+			return
+		}
+		lease := s.cfg.Lease
+		if seconds, err := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 64); err == nil && seconds > 0 {
+			lease = time.Duration(seconds) * time.Second
+		}
+		if err := s.store.SetWebSubLease(r.Context(), source.ID, time.Now().Add(lease)); err != nil {
+			log.Printf("[ERROR] failed to save WebSub lease of source %q: %v", source.Name, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[INFO] WebSub subscription for source %q verified, lease %s", source.Name, lease)
+	case "unsubscribe":
+		// We never unsubscribe from a hub we still use.
+		if ours {
+			http.NotFound(w, r)
+			return
+		}
+	case "denied":
+		if ours {
+			if err := s.store.SetWebSubLease(r.Context(), source.ID, time.Time{}); err != nil {
+				log.Printf("[ERROR] failed to drop WebSub lease of source %q: %v", source.Name, err)
+			}
+			log.Printf("[INFO] hub %q denied WebSub subscription for source %q: %s", source.WebSub.Hub, source.Name, query.Get("hub.reason"))
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, query.Get("hub.challenge"))
+}
+
+// receive takes content pushed by the hub. Content with a bad signature is
+// acknowledged but dropped, as the spec requires. Content is only taken
+// while a subscription with a secret is active or being verified; without
+// a secret anyone could push articles.
+func (s *Subscriber) receive(w http.ResponseWriter, r *http.Request) {
+	source, ok := s.source(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	subscribed := source.WebSub.Active(now) || source.WebSub.RequestedAt.After(now.Add(-retryAfter))
+	if source.WebSub.Hub == "" || source.WebSub.Secret == "" || !subscribed {
+		http.Error(w, "not subscribed", http.StatusGone)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushSize))
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validSignature(r.Header, source.WebSub.Secret, body) {
+		log.Printf("[ERROR] dropped WebSub content for source %q: invalid signature", source.Name)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := s.receiver.Push(r.Context(), source.ID, body); err != nil {
+		http.Error(w, "failed to process content", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Subscriber) source(w http.ResponseWriter, r *http.Request) (models.Source, bool) {
+	sourceID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return models.Source{}, false
+	}
+	source, err := s.store.Source(r.Context(), sourceID)
+	if err != nil {
+		log.Printf("[ERROR] WebSub callback for source %d: %v", sourceID, err)
+		http.NotFound(w, r)
+		return models.Source{}, false
+	}
+	return source, true
+}
+
+var signatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// validSignature checks the X-Hub-Signature-256 or X-Hub-Signature header
+// ("method=hex digest") against the HMAC of the body.
+func validSignature(header http.Header, secret string, body []byte) bool {
+	signature := header.Get("X-Hub-Signature-256")
+	if signature == "" {
+		signature = header.Get("X-Hub-Signature")
+	}
+	method, digest, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+	newHash, ok := signatureHashes[strings.ToLower(method)]
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("failed to generate WebSub secret")
+	}
+	return hex.EncodeToString(buf), nil
+}
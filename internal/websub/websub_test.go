@@ -0,0 +1,361 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	sources map[int64]models.Source
+}
+
+func (s *fakeStore) Source(_ context.Context, sourceID int64) (models.Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.sources[sourceID]
+	if !ok {
+		return models.Source{}, errors.New("no such source")
+	}
+	return source, nil
+}
+
+func (s *fakeStore) WebSubSources(context.Context) ([]models.Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sources []models.Source
+	for _, source := range s.sources {
+		if source.WebSub.Hub != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+func (s *fakeStore) SetWebSubRequested(_ context.Context, sourceID int64, secret string, requestedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source := s.sources[sourceID]
+	source.WebSub.Secret = secret
+	source.WebSub.RequestedAt = requestedAt
+	s.sources[sourceID] = source
+	return nil
+}
+
+func (s *fakeStore) SetWebSubLease(_ context.Context, sourceID int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source := s.sources[sourceID]
+	source.WebSub.LeaseExpiresAt = expiresAt
+	s.sources[sourceID] = source
+	return nil
+}
+
+func (s *fakeStore) get(sourceID int64) models.Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sources[sourceID]
+}
+
+type fakeReceiver struct {
+	mu     sync.Mutex
+	pushes map[int64][]string
+}
+
+func (r *fakeReceiver) Push(_ context.Context, sourceID int64, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pushes == nil {
+		r.pushes = make(map[int64][]string)
+	}
+	r.pushes[sourceID] = append(r.pushes[sourceID], string(body))
+	return nil
+}
+
+func (r *fakeReceiver) get(sourceID int64) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pushes[sourceID]
+}
+
+// fakeHub accepts subscription requests and, like a real hub, verifies the
+// intent with a GET to the callback before it considers the subscription
+// active.
+type fakeHub struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []url.Values
+	// challenges holds the challenge sent and the body echoed back.
+	challenges [][2]string
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	h.requests = append(h.requests, r.PostForm)
+	h.mu.Unlock()
+	defer w.WriteHeader(http.StatusAccepted)
+
+	// The verification may come before the hub answers; the subscriber has
+	// to cope with that, and doing it inline keeps the test synchronous.
+	challenge := "challenge-" + r.PostForm.Get("hub.topic")
+	verify, err := url.Parse(r.PostForm.Get("hub.callback"))
+	if err != nil {
+		h.t.Errorf("bad callback: %v", err)
+		return
+	}
+	query := url.Values{
+		"hub.mode":          {r.PostForm.Get("hub.mode")},
+		"hub.topic":         {r.PostForm.Get("hub.topic")},
+		"hub.challenge":     {challenge},
+		"hub.lease_seconds": {"3600"},
+	}
+	verify.RawQuery = query.Encode()
+	resp, err := http.Get(verify.String())
+	if err != nil {
+		h.t.Errorf("verification request failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	h.mu.Lock()
+	h.challenges = append(h.challenges, [2]string{challenge, string(body)})
+	h.mu.Unlock()
+}
+
+func (h *fakeHub) requestCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.requests)
+}
+
+type testEnv struct {
+	store      *fakeStore
+	receiver   *fakeReceiver
+	hub        *fakeHub
+	subscriber *Subscriber
+	callback   *httptest.Server
+}
+
+func newTestEnv(t *testing.T, sources ...models.Source) *testEnv {
+	t.Helper()
+	env := &testEnv{
+		store:    &fakeStore{sources: make(map[int64]models.Source)},
+		receiver: &fakeReceiver{},
+		hub:      &fakeHub{t: t},
+	}
+	hubServer := httptest.NewServer(env.hub)
+	t.Cleanup(hubServer.Close)
+	for _, source := range sources {
+		source.WebSub.Hub = hubServer.URL
+		env.store.sources[source.ID] = source
+	}
+
+	// The fake hub listens on loopback.
+	clients, err := httpclient.New(httpclient.Config{AllowPrivate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The callback server needs the subscriber and the subscriber needs
+	// the callback URL, so the handler is bound late.
+	var handler http.Handler
+	env.callback = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(env.callback.Close)
+	env.subscriber = New(Config{Listen: ":0", CallbackURL: env.callback.URL + "/"}, env.store, clients, env.receiver)
+	handler = env.subscriber.Handler()
+	return env
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (env *testEnv) push(t *testing.T, sourceID int64, body string, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, env.subscriber.callbackURL(sourceID), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSubscribeAndVerify(t *testing.T) {
+	env := newTestEnv(t, models.Source{ID: 1, Name: "blog", WebSub: models.WebSub{Topic: "https://blog.example/feed"}})
+
+	before := time.Now()
+	env.subscriber.Renew(context.Background())
+
+	if env.hub.requestCount() != 1 {
+		t.Fatalf("hub got %d requests, want 1", env.hub.requestCount())
+	}
+	form := env.hub.requests[0]
+	if form.Get("hub.mode") != "subscribe" || form.Get("hub.topic") != "https://blog.example/feed" {
+		t.Errorf("unexpected subscription request %v", form)
+	}
+	if want := env.callback.URL + "/websub/1"; form.Get("hub.callback") != want {
+		t.Errorf("hub.callback = %q, want %q", form.Get("hub.callback"), want)
+	}
+	if form.Get("hub.secret") == "" {
+		t.Error("subscription request has no secret")
+	}
+
+	if len(env.hub.challenges) != 1 || env.hub.challenges[0][0] != env.hub.challenges[0][1] {
+		t.Fatalf("challenge not echoed: %q", env.hub.challenges)
+	}
+	source := env.store.get(1)
+	if source.WebSub.Secret != form.Get("hub.secret") {
+		t.Error("stored secret differs from the one sent to the hub")
+	}
+	lease := source.WebSub.LeaseExpiresAt.Sub(before)
+	if lease < time.Hour-time.Minute || lease > time.Hour+time.Minute {
+		t.Errorf("lease runs for %s, want the hub's 1h", lease)
+	}
+}
+
+func TestVerifyRejectsUnknownTopic(t *testing.T) {
+	env := newTestEnv(t, models.Source{ID: 1, Name: "blog", WebSub: models.WebSub{Topic: "https://blog.example/feed", RequestedAt: time.Now()}})
+
+	query := url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://evil.example/feed"}, "hub.challenge": {"x"}}
+	resp, err := http.Get(env.subscriber.callbackURL(1) + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("verification of a foreign topic answered %d, want 404", resp.StatusCode)
+	}
+	if !env.store.get(1).WebSub.LeaseExpiresAt.IsZero() {
+		t.Error("lease stored for a foreign topic")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	const secret = "s3cret"
+	env := newTestEnv(t, models.Source{ID: 1, Name: "blog", WebSub: models.WebSub{Topic: "https://blog.example/feed", Secret: secret, LeaseExpiresAt: time.Now().Add(time.Hour)}})
+	body := `<rss><channel><item><title>Pushed</title></item></channel></rss>`
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		wantCode  int
+		delivered bool
+	}{
+		{"valid sha256", http.Header{"X-Hub-Signature-256": {sign(secret, body)}}, http.StatusNoContent, true},
+		{"valid legacy header", http.Header{"X-Hub-Signature": {sign(secret, body)}}, http.StatusNoContent, true},
+		{"wrong secret", http.Header{"X-Hub-Signature-256": {sign("other", body)}}, http.StatusAccepted, false},
+		{"malformed", http.Header{"X-Hub-Signature-256": {"sha256"}}, http.StatusAccepted, false},
+		{"unknown method", http.Header{"X-Hub-Signature": {"md5=abcd"}}, http.StatusAccepted, false},
+		{"missing", nil, http.StatusAccepted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(env.receiver.get(1))
+			if code := env.push(t, 1, body, tt.header); code != tt.wantCode {
+				t.Errorf("push answered %d, want %d", code, tt.wantCode)
+			}
+			delivered := len(env.receiver.get(1)) > before
+			if delivered != tt.delivered {
+				t.Errorf("delivered = %v, want %v", delivered, tt.delivered)
+			}
+			if delivered && env.receiver.get(1)[before] != body {
+				t.Errorf("receiver got %q", env.receiver.get(1)[before])
+			}
+		})
+	}
+}
+
+func TestReceiveWithoutSubscription(t *testing.T) {
+	const secret = "s3cret"
+	body := `<rss><channel><item><title>Pushed</title></item></channel></rss>`
+	now := time.Now()
+	tests := []struct {
+		name      string
+		websub    models.WebSub
+		signed    bool
+		delivered bool
+	}{
+		// The hub changed, which cleared the secret; Renew has not run yet.
+		{"unsigned push without a secret", models.WebSub{LeaseExpiresAt: now.Add(time.Hour)}, false, false},
+		{"lease expired", models.WebSub{Secret: secret, LeaseExpiresAt: now.Add(-time.Minute), RequestedAt: now.Add(-8 * 24 * time.Hour)}, true, false},
+		{"never subscribed", models.WebSub{Secret: secret}, true, false},
+		{"request pending", models.WebSub{Secret: secret, RequestedAt: now.Add(-time.Minute)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.websub.Topic = "https://blog.example/feed"
+			env := newTestEnv(t, models.Source{ID: 1, Name: "blog", WebSub: tt.websub})
+			var header http.Header
+			if tt.signed {
+				header = http.Header{"X-Hub-Signature-256": {sign(secret, body)}}
+			}
+			code := env.push(t, 1, body, header)
+			if delivered := len(env.receiver.get(1)) > 0; delivered != tt.delivered {
+				t.Errorf("delivered = %v (answered %d), want %v", delivered, code, tt.delivered)
+			}
+			if !tt.delivered && code != http.StatusGone {
+				t.Errorf("push answered %d, want 410", code)
+			}
+		})
+	}
+}
+
+func TestReceiveUnknownSource(t *testing.T) {
+	env := newTestEnv(t)
+	if code := env.push(t, 42, "<rss/>", nil); code != http.StatusNotFound {
+		t.Errorf("push to unknown source answered %d, want 404", code)
+	}
+}
+
+func TestRenewTiming(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		websub models.WebSub
+		want   bool
+	}{
+		{"never subscribed", models.WebSub{}, true},
+		{"lease far away", models.WebSub{LeaseExpiresAt: now.Add(24 * time.Hour), RequestedAt: now.Add(-6 * 24 * time.Hour)}, false},
+		{"lease runs out soon", models.WebSub{LeaseExpiresAt: now.Add(renewBefore / 2), RequestedAt: now.Add(-6 * 24 * time.Hour)}, true},
+		{"lease expired", models.WebSub{LeaseExpiresAt: now.Add(-time.Minute), RequestedAt: now.Add(-8 * 24 * time.Hour)}, true},
+		{"request pending", models.WebSub{RequestedAt: now.Add(-retryAfter / 2)}, false},
+		{"request unanswered", models.WebSub{RequestedAt: now.Add(-2 * retryAfter)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.websub.Topic = "https://blog.example/feed"
+			env := newTestEnv(t, models.Source{ID: 1, Name: "blog", WebSub: tt.websub})
+			env.subscriber.Renew(context.Background())
+			if got := env.hub.requestCount() > 0; got != tt.want {
+				t.Errorf("subscribed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,29 @@ package main
 
 import (
 	"context"
-	"errors"
 	"github.com/Frozelo/FeedBackManagerBot/internal/bot"
 	"github.com/Frozelo/FeedBackManagerBot/internal/config"
+	"github.com/Frozelo/FeedBackManagerBot/internal/discovery"
+	"github.com/Frozelo/FeedBackManagerBot/internal/extract"
 	"github.com/Frozelo/FeedBackManagerBot/internal/fetcher"
+	"github.com/Frozelo/FeedBackManagerBot/internal/filter"
+	"github.com/Frozelo/FeedBackManagerBot/internal/httpclient"
+	"github.com/Frozelo/FeedBackManagerBot/internal/jsonsource"
+	"github.com/Frozelo/FeedBackManagerBot/internal/model"
 	"github.com/Frozelo/FeedBackManagerBot/internal/notifier"
+	"github.com/Frozelo/FeedBackManagerBot/internal/outbox"
 	"github.com/Frozelo/FeedBackManagerBot/internal/repository"
+	"github.com/Frozelo/FeedBackManagerBot/internal/rss"
+	"github.com/Frozelo/FeedBackManagerBot/internal/scrape"
+	"github.com/Frozelo/FeedBackManagerBot/internal/supervisor"
+	"github.com/Frozelo/FeedBackManagerBot/internal/websub"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 const cfgPath = "internal/config/config.yaml"
@@ -31,6 +42,8 @@ func main() {
 		log.Panic(err)
 	}
 
+	sendQueue := outbox.New(botAPI, cfg.Outbox)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 	log.Printf("Connected to the database")
@@ -47,18 +60,95 @@ func main() {
 	sourceRepo := repository.NewSourceRepository(db)
 	articleRepo := repository.NewArticleRepository(db)
 	subsRepo := repository.NewSubscriberRepository(db)
-	rssFetcher := fetcher.NewFetcher(sourceRepo, articleRepo, 1*time.Minute, []string{"test", "hey"})
+	fetchRunRepo := repository.NewFetchRunRepository(db)
+	deliveryRepo := repository.NewDeliveryRepository(db)
+	keywordFilter, err := filter.New(cfg.Fetcher.Filters)
+	if err != nil {
+		log.Fatalf("invalid keyword rules: %v", err)
+	}
+	httpClients, err := httpclient.New(cfg.HTTP)
+	if err != nil {
+		log.Fatalf("invalid http settings: %v", err)
+	}
+	discoveryClient, err := httpClients.PublicClient("")
+	if err != nil {
+		log.Fatalf("invalid http settings: %v", err)
+	}
+
+	sourcers := fetcher.NewRegistry()
+	// RSS sources are added by users, so they may only reach public
+	// addresses; HTML and JSON sources are set up by the admin.
+	sourcers.Register(models.SourceTypeRSS, func(source models.Source) (fetcher.Sourcer, error) {
+		client, err := httpClients.PublicClient(source.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		return rss.NewRSS(source, client), nil
+	})
+	sourcers.Register(models.SourceTypeHTML, func(source models.Source) (fetcher.Sourcer, error) {
+		client, err := httpClients.Client(source.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		return scrape.NewScraper(source, client)
+	})
+	sourcers.Register(models.SourceTypeJSON, func(source models.Source) (fetcher.Sourcer, error) {
+		client, err := httpClients.Client(source.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		return jsonsource.NewJSONSource(source, client)
+	})
+	rssFetcher := fetcher.NewFetcher(sourceRepo, articleRepo, 1*time.Minute, sourcers, fetcher.Options{
+		Filter: keywordFilter,
+		Limits: fetcher.Limits{
+			Concurrency:        cfg.Fetcher.Concurrency,
+			PerHostConcurrency: cfg.Fetcher.PerHost.MaxConcurrent,
+			PerHostDelay:       cfg.Fetcher.PerHost.MinDelay,
+		},
+		Schedule: fetcher.Schedule{
+			Default: cfg.Fetcher.Schedule.DefaultInterval,
+			Min:     cfg.Fetcher.Schedule.MinInterval,
+			Max:     cfg.Fetcher.Schedule.MaxInterval,
+			Push:    cfg.Fetcher.Schedule.PushInterval,
+		},
+		Health: fetcher.Health{
+			MaxFailures: cfg.Fetcher.MaxFailures,
+			Alerter:     notifier.NewSourceAlerter(sendQueue, subsRepo, cfg.TelegramBot.Admins),
+		},
+		Dates: fetcher.Dates{
+			MaxFuture: cfg.Fetcher.Dates.MaxFuture,
+			MaxAge:    cfg.Fetcher.Dates.MaxAge,
+		},
+		Titles: fetcher.Titles{
+			Threshold: cfg.Fetcher.Titles.Threshold,
+			Window:    cfg.Fetcher.Titles.Window,
+			Disabled:  cfg.Fetcher.Titles.Disabled,
+		},
+		Runs:     fetchRunRepo,
+		FullText: extract.New(httpClients),
+	})
+	sendInterval := cfg.Notifier.SendInterval
+	if sendInterval <= 0 {
+		sendInterval = 30 * time.Second
+	}
 	ntfr := notifier.NewNotifier(
-		botAPI,
+		sendQueue,
 		userRepo,
 		articleRepo,
+		deliveryRepo,
 		subsRepo,
-		30*time.Second,
+		sendInterval,
+		notifier.Ranking{
+			PerTick:      cfg.Notifier.ArticlesPerTick,
+			PriorityStep: cfg.Notifier.PriorityStep,
+		},
 	)
-	feedBot := bot.New(botAPI)
+	feedChoices := bot.NewFeedChoices()
+	feedBot := bot.New(botAPI, sendQueue)
 	feedBot.RegisterCmd(
 		"addsource",
-		bot.CmdAddSource(sourceRepo),
+		bot.CmdAddSource(sourceRepo, subsRepo, discovery.New(discoveryClient), feedChoices),
 	)
 
 	feedBot.RegisterCmd(
@@ -66,6 +156,70 @@ func main() {
 		bot.CmdListSource(sourceRepo),
 	)
 
+	feedBot.RegisterCmd(
+		"setinterval",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdSetInterval(sourceRepo)),
+	)
+
+	feedBot.RegisterCmd(
+		"setpriority",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdSetPriority(sourceRepo, sourceRepo)),
+	)
+	feedBot.RegisterCmd(
+		"setproxy",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdSetProxy(sourceRepo, sourceRepo, httpClients)),
+	)
+
+	feedBot.RegisterCmd(
+		"weight",
+		bot.CmdWeight(sourceRepo, subsRepo),
+	)
+
+	feedBot.RegisterCmd(
+		"sourcestatus",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdSourceStatus(sourceRepo)),
+	)
+
+	feedBot.RegisterCmd(
+		"enablesource",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdEnableSource(sourceRepo)),
+	)
+
+	feedBot.RegisterCmd(
+		"fetchlog",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdFetchLog(sourceRepo, fetchRunRepo)),
+	)
+
+	feedBot.RegisterCmd(
+		"metrics",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdMetrics(rssFetcher)),
+	)
+
+	feedBot.RegisterCmd(
+		"filterstats",
+		bot.AdminOnly(cfg.TelegramBot.Admins, bot.CmdFilterStats(rssFetcher)),
+	)
+
+	feedBot.RegisterCmd(
+		"refresh",
+		bot.CmdRefresh(cfg.TelegramBot.Admins, sourceRepo, rssFetcher, sendQueue),
+	)
+
+	feedBot.RegisterCmd(
+		"import",
+		bot.CmdImport(sourceRepo, subsRepo),
+	)
+
+	feedBot.RegisterCmd(
+		"export",
+		bot.CmdExport(subsRepo),
+	)
+
+	feedBot.RegisterCmd(
+		"digest",
+		bot.CmdDigest(userRepo, ntfr),
+	)
+
 	feedBot.RegisterCmd(
 		"start",
 		bot.CmdStart(userRepo),
@@ -76,28 +230,22 @@ func main() {
 		bot.CallbackAddSource(subsRepo),
 	)
 
-	go func(ctx context.Context) {
-		if err = rssFetcher.Start(ctx); err != nil {
-			if !errors.Is(err, context.Canceled) {
-				log.Printf("Error starting fetcher: %v", err)
-				return
-			}
-			log.Printf("[INFO] fetcher stopped")
-		}
-	}(ctx)
-
-	go func(ctx context.Context) {
-		if err = ntfr.Start(ctx); err != nil {
-			if !errors.Is(err, context.Canceled) {
-				log.Printf("Error starting notifier: %v", err)
-				return
-			}
-			log.Printf("[INFO] notifier stopped")
-		}
-	}(ctx)
+	feedBot.RegisterCallback(
+		"feed_pick",
+		bot.CallbackPickFeed(sourceRepo, subsRepo, feedChoices),
+	)
 
-	if err := feedBot.Start(ctx); err != nil {
-		log.Printf("[ERROR] failed to run botkit: %v", err)
+	workers := supervisor.New(1*time.Second, 5*time.Minute)
+	workers.Add("outbox", sendQueue.Start)
+	workers.Add("fetcher", rssFetcher.Start)
+	workers.Add("notifier", ntfr.Start)
+	workers.Add("bot", feedBot.Start)
+	if pushSubscriber := websub.New(cfg.WebSub, sourceRepo, httpClients, rssFetcher); pushSubscriber.Enabled() {
+		workers.Add("websub", pushSubscriber.Start)
 	}
 
+	if err := workers.Run(ctx); err != nil {
+		log.Printf("[ERROR] shutting down: %v", err)
+	}
+	log.Printf("[INFO] stopped, restarts: %v", workers.Restarts())
 }
@@ -0,0 +1,6 @@
+ALTER TABLE sources
+    ADD COLUMN IF NOT EXISTS fetch_interval_seconds  INTEGER   NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS pinned_interval_seconds INTEGER   NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_fetch_at           TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+CREATE INDEX IF NOT EXISTS sources_next_fetch_at_idx ON sources (next_fetch_at);
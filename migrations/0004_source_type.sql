@@ -0,0 +1,2 @@
+ALTER TABLE sources
+    ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'rss';
@@ -0,0 +1,7 @@
+ALTER TABLE articles
+    ADD COLUMN IF NOT EXISTS guid       TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary    TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS content    TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS author     TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS categories TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS enclosures JSONB  NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,8 @@
+ALTER TABLE sources
+    ADD COLUMN IF NOT EXISTS last_success_at      TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS last_error_at        TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS last_error           TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS avg_latency_ms       BIGINT  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS disabled             BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS disabled_at          TIMESTAMP;
@@ -0,0 +1,9 @@
+ALTER TABLE articles
+    ADD COLUMN IF NOT EXISTS canonical_link TEXT NOT NULL DEFAULT '';
+
+-- Existing rows keep their raw link; new rows get the normalised one.
+UPDATE articles SET canonical_link = link WHERE canonical_link = '';
+
+CREATE INDEX IF NOT EXISTS articles_canonical_link_idx ON articles (canonical_link);
+CREATE INDEX IF NOT EXISTS articles_source_published_at_idx ON articles (source_id, published_at);
+CREATE UNIQUE INDEX IF NOT EXISTS articles_source_guid_uidx ON articles (source_id, guid) WHERE guid <> '';
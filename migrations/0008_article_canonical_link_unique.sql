@@ -0,0 +1,11 @@
+-- Batch ingestion relies on ON CONFLICT DO NOTHING, which needs the
+-- canonical link to be unique rather than checked with NOT EXISTS.
+DROP INDEX IF EXISTS articles_canonical_link_idx;
+
+DELETE FROM articles a
+    USING articles b
+WHERE a.canonical_link = b.canonical_link
+  AND a.canonical_link <> ''
+  AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS articles_canonical_link_uidx ON articles (canonical_link) WHERE canonical_link <> '';
@@ -0,0 +1,2 @@
+ALTER TABLE sources
+    ADD COLUMN IF NOT EXISTS proxy TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE articles
+    ADD COLUMN IF NOT EXISTS image_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE articles
+    ADD COLUMN IF NOT EXISTS first_seen_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+-- Undated rows from before the sanity checks sort by when we first saw them.
+UPDATE articles SET published_at = first_seen_at WHERE published_at IS NULL OR published_at < '1971-01-01';
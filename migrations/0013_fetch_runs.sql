@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS fetch_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    source_id   BIGINT    NOT NULL REFERENCES sources (id) ON DELETE CASCADE,
+    started_at  TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    http_status INTEGER   NOT NULL DEFAULT 0,
+    items       INTEGER   NOT NULL DEFAULT 0,
+    new         INTEGER   NOT NULL DEFAULT 0,
+    duplicates  INTEGER   NOT NULL DEFAULT 0,
+    filtered    INTEGER   NOT NULL DEFAULT 0,
+    error       TEXT      NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS fetch_runs_source_started_at_idx ON fetch_runs (source_id, started_at DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE sources
+    ADD COLUMN IF NOT EXISTS websub_hub              TEXT      NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS websub_topic            TEXT      NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS websub_secret           TEXT      NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS websub_requested_at     TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS websub_lease_expires_at TIMESTAMP;
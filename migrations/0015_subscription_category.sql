@@ -0,0 +1,10 @@
+-- Importing OPML re-subscribes users to feeds they may already follow, so a
+-- subscription has to be unique.
+DELETE FROM subscriptions a
+    USING subscriptions b
+    WHERE a.ctid > b.ctid AND a.user_id = b.user_id AND a.source_id = b.source_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_user_source_uidx ON subscriptions (user_id, source_id);
+
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
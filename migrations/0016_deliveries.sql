@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS deliveries (
+    user_id    BIGINT    NOT NULL,
+    article_id BIGINT    NOT NULL REFERENCES articles (id) ON DELETE CASCADE,
+    status     TEXT      NOT NULL,
+    message_id BIGINT    NOT NULL DEFAULT 0,
+    attempts   INTEGER   NOT NULL DEFAULT 0,
+    error      TEXT      NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, article_id)
+);
+
+-- Articles already posted under the global flag are not sent again; we do
+-- not know who got them, so they are recorded as skipped.
+INSERT INTO deliveries (user_id, article_id, status, updated_at)
+SELECT s.user_id, a.id, 'skipped', a.posted_at
+FROM articles a
+JOIN subscriptions s ON s.source_id = a.source_id
+WHERE a.posted_at IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+-- New subscribers get what arrived shortly before they subscribed, not the
+-- whole history of the source. Existing subscriptions keep their backlog.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS subscribed_at TIMESTAMP NOT NULL DEFAULT '-infinity';
+ALTER TABLE subscriptions
+    ALTER COLUMN subscribed_at SET DEFAULT (now() AT TIME ZONE 'utc');
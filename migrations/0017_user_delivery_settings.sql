@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS delivery_mode  TEXT    NOT NULL DEFAULT 'instant',
+    ADD COLUMN IF NOT EXISTS digest_minute  INTEGER NOT NULL DEFAULT 540,
+    ADD COLUMN IF NOT EXISTS digest_weekday INTEGER NOT NULL DEFAULT -1,
+    ADD COLUMN IF NOT EXISTS timezone       TEXT    NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMP;
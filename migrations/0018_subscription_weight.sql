@@ -0,0 +1,4 @@
+-- A subscriber's own boost or damping of a source, added to the source
+-- priority when articles are ranked for delivery.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 0;
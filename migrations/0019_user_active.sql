@@ -0,0 +1,13 @@
+-- /start reactivates a known user instead of adding one, so a user has to
+-- be unique.
+DELETE FROM users a
+    USING users b
+    WHERE a.ctid > b.ctid AND a.tg_id = b.tg_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_tg_id_uidx ON users (tg_id);
+
+-- Users whose chat blocked the bot or went away are kept but not sent to.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS active            BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN IF NOT EXISTS inactive_reason   TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS inactive_since    TIMESTAMP;
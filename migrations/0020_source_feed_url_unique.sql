@@ -0,0 +1,34 @@
+-- Adding a source relies on ON CONFLICT, so a feed URL has to be unique.
+-- Feeds stored twice by concurrent /addsource calls are merged into the
+-- oldest source, which takes over the subscriptions and articles of the
+-- others.
+UPDATE subscriptions s
+SET source_id = d.keep_id
+FROM (SELECT id, min(id) OVER (PARTITION BY feed_url) AS keep_id FROM sources) d
+WHERE s.source_id = d.id
+  AND d.id <> d.keep_id
+  AND NOT EXISTS (SELECT 1 FROM subscriptions o WHERE o.user_id = s.user_id AND o.source_id = d.keep_id);
+
+DELETE FROM subscriptions s
+    USING (SELECT id, min(id) OVER (PARTITION BY feed_url) AS keep_id FROM sources) d
+WHERE s.source_id = d.id
+  AND d.id <> d.keep_id;
+
+UPDATE articles a
+SET source_id = d.keep_id
+FROM (SELECT id, min(id) OVER (PARTITION BY feed_url) AS keep_id FROM sources) d
+WHERE a.source_id = d.id
+  AND d.id <> d.keep_id
+  AND (a.guid = '' OR NOT EXISTS (SELECT 1 FROM articles o WHERE o.source_id = d.keep_id AND o.guid = a.guid));
+
+DELETE FROM articles a
+    USING (SELECT id, min(id) OVER (PARTITION BY feed_url) AS keep_id FROM sources) d
+WHERE a.source_id = d.id
+  AND d.id <> d.keep_id;
+
+DELETE FROM sources a
+    USING sources b
+WHERE a.feed_url = b.feed_url
+  AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sources_feed_url_uidx ON sources (feed_url);
@@ -0,0 +1,4 @@
+-- Items dropped for a similar title are counted apart from the ones whose
+-- link or GUID is already stored.
+ALTER TABLE fetch_runs
+    ADD COLUMN IF NOT EXISTS title_duplicates INTEGER NOT NULL DEFAULT 0;